@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clientIP returns the address of the client, as passed on by the reverse proxy when
+// there is one: the first address of X-Forwarded-For, or X-Real-IP.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// audit records a state-changing action in the audit log. The action is done already, so
+// failing to record it is logged rather than reported to the user.
+func (s *server) audit(r *http.Request, action string, target string, before string, after string) {
+	err := s.store.AddAuditEntry(AuditEntry{
+		CreatedAt: time.Now(),
+		Actor:     getActor(r),
+		IP:        clientIP(r),
+		Action:    action,
+		Target:    target,
+		Before:    before,
+		After:     after,
+	})
+	if err != nil {
+		log.Printf("Failed to record %s of %s in the audit log: %v", action, target, err)
+	}
+}
+
+// setSetting changes a setting and records the change in the audit log.
+func (s *server) setSetting(r *http.Request, setting string, value string) error {
+	before, err := s.store.GetSetting(setting)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if err := s.store.SetSetting(setting, value); err != nil {
+		return err
+	}
+	if before != value {
+		s.audit(r, "setting.update", setting, before, value)
+	}
+	return nil
+}
+
+// carryAuditLog appends to the audit log of a restored database the entries recorded
+// since the backup was taken, out of the entries read before restoring, newest first.
+// The newest restored entry is looked up by its time and content, IDs don't match
+// across databases. When it isn't found, the backup comes from another database and
+// nothing is carried over. A restored database without audit log gets all entries.
+func (s *server) carryAuditLog(entries []AuditEntry) error {
+	restored, err := s.store.AuditLog(AuditFilter{Limit: 1})
+	if err != nil {
+		return err
+	}
+
+	carried := entries
+	if len(restored) > 0 {
+		carried = nil
+		for i, entry := range entries {
+			if sameAuditEntry(entry, restored[0]) {
+				carried = entries[:i]
+				break
+			}
+			if i == len(entries)-1 {
+				log.Println("The restored audit log doesn't share entries with the current one, it isn't carried over")
+			}
+		}
+	}
+
+	for i := len(carried) - 1; i >= 0; i-- {
+		if err := s.store.AddAuditEntry(carried[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameAuditEntry reports whether two entries record the same action, ignoring their IDs.
+func sameAuditEntry(a AuditEntry, b AuditEntry) bool {
+	return a.CreatedAt.Equal(b.CreatedAt) && a.Actor == b.Actor && a.IP == b.IP && a.Action == b.Action &&
+		a.Target == b.Target && a.Before == b.Before && a.After == b.After
+}
+
+// linkJSON describes a link for the audit log.
+func linkJSON(link Link) string {
+	data, _ := json.Marshal(versionOf(link))
+	return string(data)
+}
+
+// auditFilter reads the filters of the audit page and export from the query string.
+func auditFilter(r *http.Request) (AuditFilter, error) {
+	filter := AuditFilter{
+		Actor:  r.FormValue("actor"),
+		Action: r.FormValue("action"),
+		Search: r.FormValue("search"),
+	}
+	if since := r.FormValue("since"); since != "" {
+		t, err := time.ParseInLocation("2006-01-02", since, time.Local)
+		if err != nil {
+			return filter, err
+		}
+		filter.Since = t
+	}
+	if until := r.FormValue("until"); until != "" {
+		t, err := time.ParseInLocation("2006-01-02", until, time.Local)
+		if err != nil {
+			return filter, err
+		}
+		// The whole day is included
+		filter.Until = t.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
+
+func (s *server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		http.Error(w, "Dates must look like 2024-12-31.", http.StatusBadRequest)
+		return
+	}
+	filter.Limit = 500
+
+	entries, err := s.store.AuditLog(filter)
+	if err != nil {
+		http.Error(w, "Failed to fetch the audit log.", http.StatusInternalServerError)
+		return
+	}
+
+	var item struct {
+		Filter  map[string]string
+		Query   string
+		Entries []struct {
+			AuditEntry
+			When string
+		}
+	}
+	item.Filter = map[string]string{
+		"actor":  r.FormValue("actor"),
+		"action": r.FormValue("action"),
+		"search": r.FormValue("search"),
+		"since":  r.FormValue("since"),
+		"until":  r.FormValue("until"),
+	}
+	item.Query = r.URL.RawQuery
+	for _, entry := range entries {
+		item.Entries = append(item.Entries, struct {
+			AuditEntry
+			When string
+		}{entry, entry.CreatedAt.Local().Format("2006-01-02 15:04:05")})
+	}
+
+	// Render the audit page
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	</head>
+	<body>
+		<h2><a href="/">Audit log</a></h2>
+		<form action="/audit/" method="get">
+			<input type="text" name="actor" value="{{index .Filter "actor"}}" placeholder="Actor" autocomplete="off">
+			<input type="text" name="action" value="{{index .Filter "action"}}" placeholder="Action, like link. or setting." autocomplete="off">
+			<input type="text" name="search" value="{{index .Filter "search"}}" placeholder="Target or value contains" autocomplete="off">
+			<label for="since">From</label>
+			<input type="date" name="since" id="since" value="{{index .Filter "since"}}">
+			<label for="until">to</label>
+			<input type="date" name="until" id="until" value="{{index .Filter "until"}}">
+			<button type="submit">Filter</button>
+			<button type="button" onclick="window.location.href = '/audit.json?{{.Query}}'">Export JSON</button>
+		</form>
+		</p>
+		<table class="links">
+			<tr>
+				<th style="text-align: center; width: 160px">When</th>
+				<th style="text-align: center; width: 120px">Actor</th>
+				<th style="text-align: center; width: 120px">IP</th>
+				<th style="text-align: left; width: 140px">Action</th>
+				<th style="text-align: left;">Target</th>
+				<th style="text-align: left;">Before</th>
+				<th style="text-align: left;">After</th>
+			</tr>
+			{{range .Entries}}
+			<tr>
+				<td style="text-align: center;">{{.When}}</td>
+				<td style="text-align: center;">{{if .Actor}}{{.Actor}}{{else}}-{{end}}</td>
+				<td style="text-align: center;">{{.IP}}</td>
+				<td><code>{{.Action}}</code></td>
+				<td>{{.Target}}</td>
+				<td><code>{{.Before}}</code></td>
+				<td><code>{{.After}}</code></td>
+			</tr>
+			{{else}}
+			<tr><td colspan="7">Nothing recorded yet.</td></tr>
+			{{end}}
+		</table>
+		The last 500 matching entries are shown, the JSON export has them all. Entries can't be changed nor deleted, the database refuses it. (<a href="/help/#audit">?</a>)
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("audit").Parse(tmpl))
+	tmplParsed.Execute(w, item)
+}
+
+func (s *server) handleAuditJSON(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		http.Error(w, "Dates must look like 2024-12-31.", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := s.store.AuditLog(filter)
+	if err != nil {
+		http.Error(w, "Failed to fetch the audit log.", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="gomarks-audit-`+time.Now().Format(backupTimestampLayout)+`.json"`)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(entries)
+}
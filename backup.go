@@ -0,0 +1,930 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backups are named after the database followed by this timestamp
+const backupTimestampLayout = "20060102_150405"
+
+// Uploaded backups carry this suffix after their timestamp, which is the time of the
+// upload rather than of the backup
+const uploadSuffix = ".upload"
+
+// Intervals of the backup schedules
+var backupSchedules = map[string]time.Duration{
+	"hourly": time.Hour,
+	"daily":  24 * time.Hour,
+}
+
+// requireSQLite answers that backups are unavailable and returns false when the database
+// isn't a SQLite file. PostgreSQL databases are backed up with the tools of the database server.
+func (s *server) requireSQLite(w http.ResponseWriter) bool {
+	if s.dbPath == "" {
+		http.Error(w, "Backups are only available with SQLite storage, use pg_dump for PostgreSQL.", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
+
+func (s *server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if !s.requireSQLite(w) {
+		return
+	}
+
+	start := time.Now()
+	path, err := s.backup()
+	if err != nil {
+		log.Println("Backup failed with error:", err)
+		http.Error(w, "Backup failed: "+err.Error(), 500)
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		http.Error(w, "Backup failed: "+err.Error(), 500)
+		return
+	}
+
+	duration := time.Since(start).Round(time.Millisecond)
+	log.Printf("Database backup success: %s (%s in %s)", path, formatSize(info.Size()), duration)
+	s.audit(r, "backup.create", filepath.Base(path), "", "")
+
+	if s.s3 != nil {
+		if err := s.s3.Upload(path, filepath.Base(path)); err != nil {
+			log.Println("Offsite backup failed with error:", err)
+			http.Error(w, "Backup saved locally as "+filepath.Base(path)+" but the offsite copy failed: "+err.Error(), 500)
+			return
+		}
+	}
+	s.applyRetention()
+
+	if s.s3 != nil {
+		duration = time.Since(start).Round(time.Millisecond)
+		fmt.Fprintf(w, "Backup created successfully: %s (%s in %s), copied to %s", filepath.Base(path), formatSize(info.Size()), duration, s.s3)
+		return
+	}
+	fmt.Fprintf(w, "Backup created successfully: %s (%s in %s)", filepath.Base(path), formatSize(info.Size()), duration)
+}
+
+// backup writes a copy of the database in the backup directory and returns its path.
+func (s *server) backup() (string, error) {
+	if s.dbPath == "" {
+		return "", ErrUnsupported
+	}
+
+	path, err := s.claimBackupPath(time.Now(), "")
+	if err != nil {
+		return "", err
+	}
+	if s.cipher == nil {
+		// VACUUM INTO accepts the empty file claiming the name
+		if err := s.store.Backup(path); err != nil {
+			os.Remove(path)
+			return path, err
+		}
+		return path, nil
+	}
+
+	// The plain snapshot of an encrypted backup never sits in the backup directory
+	dir, err := os.MkdirTemp("", "gomarks-")
+	if err != nil {
+		os.Remove(path)
+		return path, err
+	}
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, filepath.Base(path))
+	err = s.store.Backup(snapshot)
+	if err == nil {
+		err = s.encryptBackup(snapshot, path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		os.Remove(path)
+		return path, err
+	}
+	return path, nil
+}
+
+// claimBackupPath creates an empty file named like a backup taken at t followed by suffix,
+// or a second later when two backups are taken within the same second, so no backup is replaced.
+func (s *server) claimBackupPath(t time.Time, suffix string) (string, error) {
+	for i := 0; i < 60; i++ {
+		name := fmt.Sprintf("%s.%s%s", filepath.Base(s.dbPath), t.Add(time.Duration(i)*time.Second).Format(backupTimestampLayout), suffix)
+		path := filepath.Join(s.backupDir, name)
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return path, file.Close()
+	}
+	return "", errors.New("a backup was taken every second of the last minute already")
+}
+
+func (s *server) handleBackupDownload(w http.ResponseWriter, r *http.Request) {
+	if !s.requireSQLite(w) {
+		return
+	}
+
+	// The snapshot is taken in a temporary directory and never shows up with the backups
+	dir, err := os.MkdirTemp("", "gomarks-")
+	if err != nil {
+		http.Error(w, "Backup failed: "+err.Error(), 500)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := fmt.Sprintf("%s.%s", filepath.Base(s.dbPath), time.Now().Format(backupTimestampLayout))
+	path := filepath.Join(dir, name)
+	if err := s.store.Backup(path); err != nil {
+		log.Println("Backup failed with error:", err)
+		http.Error(w, "Backup failed: "+err.Error(), 500)
+		return
+	}
+
+	compress := r.FormValue("gzip") != ""
+
+	// Encrypted downloads are sealed in memory, compressed first since ciphertext doesn't compress
+	if s.cipher != nil {
+		data, err := os.ReadFile(path)
+		if err == nil && compress {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(data)
+			err = zw.Close()
+			data = buf.Bytes()
+			name += ".gz"
+		}
+		if err == nil {
+			data, err = s.cipher.Encrypt(data)
+		}
+		if err != nil {
+			log.Println("Backup failed with error:", err)
+			http.Error(w, "Backup failed: "+err.Error(), 500)
+			return
+		}
+
+		name += ".enc"
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		w.Write(data)
+		log.Println("Database backup downloaded:", name)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Backup failed: "+err.Error(), 500)
+		return
+	}
+	defer file.Close()
+
+	if compress {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".gz"))
+		zw := gzip.NewWriter(w)
+		_, err = io.Copy(zw, file)
+		if err == nil {
+			err = zw.Close()
+		}
+	} else {
+		if info, statErr := file.Stat(); statErr == nil {
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		}
+		w.Header().Set("Content-Type", "application/vnd.sqlite3")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		_, err = io.Copy(w, file)
+	}
+	if err != nil {
+		// Headers are gone already, the client sees a truncated download
+		log.Println("Backup download failed with error:", err)
+		return
+	}
+
+	log.Println("Database backup downloaded:", name)
+}
+
+// formatSize returns a size in bytes as a human readable string.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// formatAge returns how long ago something happened, roughly.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%d minutes ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d hours ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d days ago", int(d.Hours()/24))
+	}
+}
+
+// backupFile is a backup found in the backup directory.
+type backupFile struct {
+	Name     string
+	Size     int64
+	Time     time.Time
+	Uploaded bool
+}
+
+// listBackups returns the backups of the database, newest first.
+func (s *server) listBackups() ([]backupFile, error) {
+	entries, err := os.ReadDir(s.backupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(s.dbPath) + "."
+	var backups []backupFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		// Other files next to the database, like its WAL, don't carry a timestamp
+		stamp, uploaded := strings.CutSuffix(strings.TrimPrefix(name, prefix), uploadSuffix)
+		taken, err := time.ParseInLocation(backupTimestampLayout, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backupFile{Name: name, Size: info.Size(), Time: taken, Uploaded: uploaded})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// retainedBackups applies a grandfather-father-son policy to backups sorted newest first:
+// the newest backup of each of the last daily days and of each of the last weekly weeks
+// are kept. The newest backup is always kept. Uploads are kept until deleted by hand and
+// don't take a day or a week, their time is only when they were uploaded.
+func retainedBackups(backups []backupFile, daily int, weekly int) map[string]bool {
+	keep := make(map[string]bool)
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	newest := true
+	for _, backup := range backups {
+		if backup.Uploaded {
+			keep[backup.Name] = true
+			continue
+		}
+		if newest {
+			keep[backup.Name] = true
+			newest = false
+		}
+
+		day := backup.Time.Format("2006-01-02")
+		if !days[day] && len(days) < daily {
+			days[day] = true
+			keep[backup.Name] = true
+		}
+
+		year, week := backup.Time.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+		if !weeks[weekKey] && len(weeks) < weekly {
+			weeks[weekKey] = true
+			keep[backup.Name] = true
+		}
+	}
+	return keep
+}
+
+// pruneBackups deletes the backups the retention policy doesn't keep, locally and offsite,
+// and returns how many went. Keeping 0 daily and 0 weekly backups disables the retention policy.
+func (s *server) pruneBackups() (int, error) {
+	daily, err := s.intSetting("backup_keep_daily")
+	if err != nil {
+		return 0, err
+	}
+	weekly, err := s.intSetting("backup_keep_weekly")
+	if err != nil {
+		return 0, err
+	}
+	if daily == 0 && weekly == 0 {
+		return 0, nil
+	}
+
+	backups, err := s.listBackups()
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := pruneWith(backups, daily, weekly, func(name string) error {
+		return os.Remove(filepath.Join(s.backupDir, name))
+	})
+	if err != nil || s.s3 == nil {
+		return pruned, err
+	}
+
+	remote, err := s.listOffsiteBackups()
+	if err != nil {
+		return pruned, err
+	}
+	prunedRemote, err := pruneWith(remote, daily, weekly, s.s3.Delete)
+	return pruned + prunedRemote, err
+}
+
+// pruneWith calls remove on the backups the retention policy doesn't keep.
+func pruneWith(backups []backupFile, daily int, weekly int, remove func(name string) error) (int, error) {
+	keep := retainedBackups(backups, daily, weekly)
+	pruned := 0
+	for _, backup := range backups {
+		if keep[backup.Name] {
+			continue
+		}
+		if err := remove(backup.Name); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// listOffsiteBackups returns the backups of the database in the bucket, newest first.
+func (s *server) listOffsiteBackups() ([]backupFile, error) {
+	objects, err := s.s3.List()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(s.dbPath) + "."
+	var backups []backupFile
+	for _, object := range objects {
+		// Objects in subfolders of the prefix or from other tools are left alone
+		if !strings.HasPrefix(object.Key, prefix) {
+			continue
+		}
+		taken, err := time.ParseInLocation(backupTimestampLayout, strings.TrimPrefix(object.Key, prefix), time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{Name: object.Key, Size: object.Size, Time: taken})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+func (s *server) intSetting(setting string) (int, error) {
+	value, err := s.store.GetSetting(setting)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// runSchedule runs the background tasks every minute: it deletes the deprecated keywords
+// past their transition period and the links trashed long enough ago, and takes the
+// scheduled backups. The settings are read every time, so changes apply without a restart.
+func (s *server) runSchedule() {
+	s.purgeExpired(time.Now())
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.purgeExpired(now)
+		if s.dbPath != "" {
+			s.scheduledBackup(now)
+		}
+	}
+}
+
+func (s *server) purgeExpired(now time.Time) {
+	if err := s.store.PurgeAliases(now); err != nil {
+		log.Println("Purging deprecated keywords failed with error:", err)
+	}
+	if err := s.purgeTrash(); err != nil {
+		log.Println("Emptying the trash failed with error:", err)
+	}
+}
+
+// scheduledBackup takes a backup when the last one is older than the schedule interval,
+// then applies the retention policy.
+func (s *server) scheduledBackup(now time.Time) {
+	schedule, err := s.store.GetSetting("backup_schedule")
+	if err != nil {
+		log.Println("Scheduled backup failed with error:", err)
+		return
+	}
+	interval, ok := backupSchedules[schedule]
+	if !ok {
+		return
+	}
+
+	backups, err := s.listBackups()
+	if err != nil {
+		log.Println("Scheduled backup failed with error:", err)
+		return
+	}
+	// Allow for the ticker granularity so backups don't drift later every time. Uploads
+	// aren't backups of this database and don't put the next one off.
+	for _, backup := range backups {
+		if backup.Uploaded {
+			continue
+		}
+		if now.Sub(backup.Time) < interval-time.Minute {
+			return
+		}
+		break
+	}
+
+	path, err := s.backup()
+	if err != nil {
+		log.Println("Scheduled backup failed with error:", err)
+		return
+	}
+	log.Println("Scheduled database backup success:", path)
+
+	if s.s3 != nil {
+		if err := s.s3.Upload(path, filepath.Base(path)); err != nil {
+			log.Println("Offsite backup failed with error:", err)
+		} else {
+			log.Println("Backup copied to", s.s3)
+		}
+	}
+
+	s.applyRetention()
+}
+
+// applyRetention prunes the backups after one was added. The safety backups of restores
+// are left for the next one, pruning then could delete the backup being restored.
+func (s *server) applyRetention() {
+	pruned, err := s.pruneBackups()
+	if err != nil {
+		log.Println("Pruning backups failed with error:", err)
+		return
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d old backups", pruned)
+	}
+}
+
+func (s *server) handleBackups(w http.ResponseWriter, r *http.Request) {
+	if !s.requireSQLite(w) {
+		return
+	}
+
+	var item struct {
+		Schedule string
+		Daily    string
+		Weekly   string
+		Dir      string
+		Offsite  string
+		Backups  []struct {
+			Name string
+			Size string
+			Age  string
+		}
+	}
+	item.Dir = s.backupDir
+	if s.s3 != nil {
+		item.Offsite = s.s3.String()
+	}
+
+	var err error
+	item.Schedule, err = s.store.GetSetting("backup_schedule")
+	if err == nil {
+		item.Daily, err = s.store.GetSetting("backup_keep_daily")
+	}
+	if err == nil {
+		item.Weekly, err = s.store.GetSetting("backup_keep_weekly")
+	}
+	if err != nil {
+		http.Error(w, "Backup settings not found.", http.StatusNotFound)
+		return
+	}
+
+	backups, err := s.listBackups()
+	if err != nil {
+		http.Error(w, "Failed to list backups.", http.StatusInternalServerError)
+		return
+	}
+	for _, backup := range backups {
+		item.Backups = append(item.Backups, struct {
+			Name string
+			Size string
+			Age  string
+		}{backup.Name, formatSize(backup.Size), formatAge(time.Since(backup.Time))})
+	}
+
+	// Render the backups page
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	    <script>
+        function goToIndex() {
+            window.location.href = "/";
+        }
+        function backup() {
+            fetch('/backup', { method: 'POST' })
+                .then(res => res.text())
+                .then(alert)
+                .then(() => window.location.reload())
+                .catch(err => alert("Error: " + err));
+        }
+    </script>
+	</head>
+	<body>
+		<h2><a href="/">Backups</a></h2>
+		<form action="/backups-post/" method="post">
+			<label for="schedule">Schedule</label>
+			<select name="schedule" id="schedule">
+				<option value="off" {{if eq .Schedule "off"}}selected{{end}}>Off</option>
+				<option value="hourly" {{if eq .Schedule "hourly"}}selected{{end}}>Hourly</option>
+				<option value="daily" {{if eq .Schedule "daily"}}selected{{end}}>Daily</option>
+			</select></p>
+			<label for="daily">Daily backups to keep</label>
+			<input type="number" name="daily" id="daily" value="{{.Daily}}" min="0" max="1000" required></p>
+			<label for="weekly">Weekly backups to keep</label>
+			<input type="number" name="weekly" id="weekly" value="{{.Weekly}}" min="0" max="1000" required></p>
+			<button type="submit">Save</button></p>
+			<button type="button" onclick="goToIndex()">Cancel</button>
+		</form>
+		Old backups are pruned after each scheduled backup, keeping the newest backup of each day and week. Keep 0 daily and 0 weekly backups to never prune. (<a href="/help/#backup">?</a>)</p>
+		{{if .Offsite}}Backups are also copied to <code>{{.Offsite}}</code>, where the same retention applies.</p>{{end}}
+
+		<h2>Backups in <code>{{.Dir}}</code></h2>
+		<table class="links">
+			<tr>
+				<th style="text-align: left;">File</th>
+				<th style="text-align: center; width: 100px">Size</th>
+				<th style="text-align: center; width: 150px">Age</th>
+				<th style="text-align: center; width: 100px">Management</th>
+			</tr>
+			{{range .Backups}}
+			<tr>
+				<td><code>{{.Name}}</code></td>
+				<td style="text-align: center;">{{.Size}}</td>
+				<td style="text-align: center;">{{.Age}}</td>
+				<td style="text-align: center;">
+					<a href="/restore/{{.Name}}" title="Restore backup">♻️</a>
+					<form action="/backups-del/{{.Name}}" method="post" style="display: inline;">
+						<button type="submit" title="Delete backup" onclick="return confirm('Delete {{.Name}}?')">❌</button>
+					</form>
+				</td>
+			</tr>
+			{{else}}
+			<tr><td colspan="4">No backups yet.</td></tr>
+			{{end}}
+		</table>
+		</p>
+		<button onclick="backup()">Backup database</button>
+		<button onclick="window.location.href = '/backup-download'">Download backup</button>
+		<button onclick="window.location.href = '/backup-download?gzip=1'">Download compressed backup</button></p>
+
+		<h2>Restore from a file</h2>
+		<form action="/restore-upload" method="post" enctype="multipart/form-data">
+			<input type="file" name="file" required>
+			<button type="submit">Upload</button>
+		</form>
+		The file is checked and kept with the other backups, you can review the changes before restoring it.
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("backups").Parse(tmpl))
+	tmplParsed.Execute(w, item)
+}
+
+func (s *server) handleBackupsPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	schedule := r.FormValue("schedule")
+	if _, ok := backupSchedules[schedule]; !ok && schedule != "off" {
+		http.Error(w, "Unknown backup schedule.", http.StatusBadRequest)
+		return
+	}
+	daily, err := strconv.Atoi(r.FormValue("daily"))
+	if err != nil || daily < 0 || daily > 1000 {
+		http.Error(w, "Daily backups to keep must be between 0 and 1000.", http.StatusBadRequest)
+		return
+	}
+	weekly, err := strconv.Atoi(r.FormValue("weekly"))
+	if err != nil || weekly < 0 || weekly > 1000 {
+		http.Error(w, "Weekly backups to keep must be between 0 and 1000.", http.StatusBadRequest)
+		return
+	}
+
+	err = s.setSetting(r, "backup_schedule", schedule)
+	if err == nil {
+		err = s.setSetting(r, "backup_keep_daily", strconv.Itoa(daily))
+	}
+	if err == nil {
+		err = s.setSetting(r, "backup_keep_weekly", strconv.Itoa(weekly))
+	}
+	if err != nil {
+		http.Error(w, "Failed to update backup settings.", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/?backups=updated", http.StatusSeeOther)
+}
+
+// findBackup returns the path of a backup from its name. Only files listed as backups are
+// found, names can't point elsewhere on the filesystem.
+func (s *server) findBackup(name string) (string, error) {
+	backups, err := s.listBackups()
+	if err != nil {
+		return "", err
+	}
+	for _, backup := range backups {
+		if backup.Name == name {
+			return filepath.Join(s.backupDir, name), nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func (s *server) handleBackupsDel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireSQLite(w) {
+		return
+	}
+
+	name := r.URL.Path[len("/backups-del/"):]
+	path, err := s.findBackup(name)
+	if err != nil {
+		http.Error(w, "Backup not found.", http.StatusNotFound)
+		return
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		http.Error(w, "Failed to delete the backup.", http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("Deleted backup", name)
+	s.audit(r, "backup.delete", name, "", "")
+	http.Redirect(w, r, "/backups/", http.StatusSeeOther)
+}
+
+// restoreDiff lists the links a restore would add, remove or change, by name.
+type restoreDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+func diffLinks(current []Link, restored []Link) restoreDiff {
+	var diff restoreDiff
+	existing := make(map[string]Link)
+	for _, link := range current {
+		existing[link.Name] = link
+	}
+	for _, link := range restored {
+		old, ok := existing[link.Name]
+		if !ok {
+			diff.Added = append(diff.Added, link.Name)
+		} else if *versionOf(old) != *versionOf(link) {
+			diff.Changed = append(diff.Changed, link.Name)
+		}
+		delete(existing, link.Name)
+	}
+	for name := range existing {
+		diff.Removed = append(diff.Removed, name)
+	}
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+func (s *server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if !s.requireSQLite(w) {
+		return
+	}
+
+	name := r.URL.Path[len("/restore/"):]
+	path, err := s.findBackup(name)
+	if err != nil {
+		http.Error(w, "Backup not found.", http.StatusNotFound)
+		return
+	}
+
+	plain, cleanup, err := s.openBackup(path)
+	if err != nil {
+		http.Error(w, "This backup can't be restored: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cleanup()
+
+	restored, err := readSQLiteBackup(plain)
+	if err != nil {
+		http.Error(w, "This backup can't be restored: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	current, err := s.store.ListLinks()
+	if err != nil {
+		http.Error(w, "Failed to fetch items.", http.StatusInternalServerError)
+		return
+	}
+
+	// Render the restore page
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	    <script>
+        function goToBackups() {
+            window.location.href = "/backups/";
+        }
+    </script>
+	</head>
+	<body>
+		<h2><a href="/">Restore {{.Name}}</a></h2>
+		The backup {{if .Unpacked}}was decrypted or decompressed and {{end}}passed the integrity check and holds {{.Total}} shortcuts. Compared to the current database, restoring it will:</p>
+		<ul>
+			<li>add {{len .Diff.Added}} shortcuts{{range .Diff.Added}} <code>{{.}}</code>{{end}}</li>
+			<li>remove {{len .Diff.Removed}} shortcuts{{range .Diff.Removed}} <code>{{.}}</code>{{end}}</li>
+			<li>change {{len .Diff.Changed}} shortcuts{{range .Diff.Changed}} <code>{{.}}</code>{{end}}</li>
+		</ul>
+		Settings, variables, aliases and history are replaced as well. A backup of the current database is taken first, so a restore can be undone.</p>
+		<form action="/restore-post/{{.Name}}" method="post">
+			<button type="submit" onclick="return confirm('Replace the current database with {{.Name}}?')">Restore</button></p>
+			<button type="button" onclick="goToBackups()">Cancel</button>
+		</form>
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("restore").Parse(tmpl))
+	tmplParsed.Execute(w, struct {
+		Name     string
+		Unpacked bool
+		Total    int
+		Diff     restoreDiff
+	}{name, plain != path, len(restored), diffLinks(current, restored)})
+}
+
+func (s *server) handleRestorePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireSQLite(w) {
+		return
+	}
+
+	name := r.URL.Path[len("/restore-post/"):]
+	path, err := s.findBackup(name)
+	if err != nil {
+		http.Error(w, "Backup not found.", http.StatusNotFound)
+		return
+	}
+	plain, cleanup, err := s.openBackup(path)
+	if err != nil {
+		http.Error(w, "This backup can't be restored: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cleanup()
+	if _, err := readSQLiteBackup(plain); err != nil {
+		http.Error(w, "This backup can't be restored: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Keep a way back before touching anything
+	safety, err := s.backup()
+	if err != nil {
+		log.Println("Safety backup before restore failed with error:", err)
+		http.Error(w, "Failed to back up the current database, nothing was restored: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The audit log outlives restores, what was recorded since the backup is carried over
+	entries, err := s.store.AuditLog(AuditFilter{})
+	if err != nil {
+		http.Error(w, "Failed to fetch the audit log, nothing was restored.", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.store.Restore(plain)
+	if err != nil {
+		log.Println("Restore failed with error:", err)
+		http.Error(w, "Restore failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.carryAuditLog(entries); err != nil {
+		log.Println("Carrying the audit log over the restore failed with error:", err)
+	}
+	log.Printf("Database restored from %s, previous database saved as %s", name, safety)
+	s.audit(r, "backup.restore", name, "", "previous database saved as "+filepath.Base(safety))
+	http.Redirect(w, r, "/?restored="+name, http.StatusSeeOther)
+}
+
+// Largest backup accepted for upload
+const maxUploadSize = 256 << 20
+
+func (s *server) handleRestoreUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireSQLite(w) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "No backup file uploaded.", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Uploads land in the backup directory, hidden until they are checked
+	tmp, err := os.CreateTemp(s.backupDir, ".upload-*")
+	if err != nil {
+		http.Error(w, "Failed to store the upload.", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, file)
+	tmp.Close()
+	if err != nil {
+		http.Error(w, "Failed to store the upload.", http.StatusInternalServerError)
+		return
+	}
+
+	// Encrypted uploads are kept encrypted, the check runs on a decrypted copy
+	plain, cleanup, err := s.openBackup(tmp.Name())
+	if err != nil {
+		http.Error(w, "This file can't be restored: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cleanup()
+	if _, err := readSQLiteBackup(plain); err != nil {
+		http.Error(w, "This file can't be restored: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A checked upload is listed with the backups, marked so the retention policy leaves it alone
+	path, err := s.claimBackupPath(time.Now(), uploadSuffix)
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+		if err != nil {
+			os.Remove(path)
+		}
+	}
+	if err != nil {
+		log.Println("Storing the upload failed with error:", err)
+		http.Error(w, "Failed to store the upload.", http.StatusInternalServerError)
+		return
+	}
+	name := filepath.Base(path)
+
+	log.Println("Uploaded backup", name)
+	s.audit(r, "backup.upload", name, "", "")
+	http.Redirect(w, r, "/restore/"+name, http.StatusSeeOther)
+}
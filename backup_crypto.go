@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Encrypted backups start with a header, authenticated along with the content:
+//
+//	magic      4 bytes  "GMBK"
+//	version    1 byte   1
+//	kdf        1 byte   1 = PBKDF2-SHA256 from a passphrase, 2 = HKDF-SHA256 from a key file
+//	salt       16 bytes
+//	iterations 4 bytes  big endian, PBKDF2 only, 0 otherwise
+//	nonce      12 bytes
+//
+// followed by the database sealed with AES-256-GCM, using the header as additional data.
+// The whole backup is sealed at once, link databases are small enough for it.
+const (
+	backupMagic         = "GMBK"
+	backupFormatVersion = 1
+	backupHeaderSize    = 4 + 1 + 1 + 16 + 4 + 12
+
+	kdfPassphrase = 1
+	kdfKeyFile    = 2
+
+	// OWASP recommendation for PBKDF2-HMAC-SHA256. Headers asking for more than the
+	// maximum are refused, as the header comes with the file and could pin the CPU.
+	passphraseIterations    = 600000
+	maxPassphraseIterations = 2000000
+
+	// Decompressed backups larger than this are refused, gzip bombs fill no disk
+	maxUnpackedBackupSize = 1 << 30
+)
+
+// backupCipher encrypts backups with a passphrase or a key file, a passphrase wins when
+// both are set. Both are kept so backups made with either can be decrypted.
+type backupCipher struct {
+	passphrase string
+	keyFile    []byte
+}
+
+// newBackupCipher returns the cipher described by the config, nil when backups aren't encrypted.
+func newBackupCipher(cfg config) (*backupCipher, error) {
+	c := &backupCipher{passphrase: cfg.BackupPassphrase}
+	if cfg.BackupKeyFile != "" {
+		key, err := os.ReadFile(cfg.BackupKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) < 32 {
+			return nil, fmt.Errorf("backup key file %s is too short, it needs at least 32 bytes, for example from: head -c 32 /dev/urandom", cfg.BackupKeyFile)
+		}
+		c.keyFile = key
+	}
+	if c.passphrase == "" && c.keyFile == nil {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// isEncryptedBackup reports whether data starts like an encrypted backup.
+func isEncryptedBackup(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(backupMagic))
+}
+
+// key derives the AES-256 key for a header's kdf, salt and iterations.
+func (c *backupCipher) key(kdf byte, salt []byte, iterations uint32) ([]byte, error) {
+	switch kdf {
+	case kdfPassphrase:
+		if c == nil || c.passphrase == "" {
+			return nil, errors.New("backup is encrypted with a passphrase, set -backup-passphrase to decrypt it")
+		}
+		return pbkdf2.Key(sha256.New, c.passphrase, salt, int(iterations), 32)
+	case kdfKeyFile:
+		if c == nil || c.keyFile == nil {
+			return nil, errors.New("backup is encrypted with a key file, set -backup-key-file to decrypt it")
+		}
+		return hkdf.Key(sha256.New, c.keyFile, salt, "gomarks backup", 32)
+	}
+	return nil, fmt.Errorf("unknown backup key derivation %d", kdf)
+}
+
+// Encrypt seals a backup behind a fresh header.
+func (c *backupCipher) Encrypt(plain []byte) ([]byte, error) {
+	header := make([]byte, backupHeaderSize)
+	copy(header, backupMagic)
+	header[4] = backupFormatVersion
+	salt := header[6:22]
+	nonce := header[26:38]
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	var iterations uint32
+	if c.passphrase != "" {
+		header[5] = kdfPassphrase
+		iterations = passphraseIterations
+	} else {
+		header[5] = kdfKeyFile
+	}
+	binary.BigEndian.PutUint32(header[22:26], iterations)
+
+	aead, err := c.aead(header[5], salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, plain, header), nil
+}
+
+// Decrypt checks and opens an encrypted backup. c may be nil, the error then says what
+// is needed to decrypt the backup.
+func (c *backupCipher) Decrypt(data []byte) ([]byte, error) {
+	if len(data) < backupHeaderSize || !isEncryptedBackup(data) {
+		return nil, errors.New("not an encrypted backup")
+	}
+	header := data[:backupHeaderSize]
+	if header[4] != backupFormatVersion {
+		return nil, fmt.Errorf("encrypted backup format version %d is not supported by this binary", header[4])
+	}
+
+	iterations := binary.BigEndian.Uint32(header[22:26])
+	if header[5] == kdfPassphrase && (iterations == 0 || iterations > maxPassphraseIterations) {
+		return nil, fmt.Errorf("backup asks for %d PBKDF2 iterations, at most %d are accepted", iterations, maxPassphraseIterations)
+	}
+	aead, err := c.aead(header[5], header[6:22], iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, header[26:38], data[backupHeaderSize:], header)
+	if err != nil {
+		return nil, errors.New("backup can't be decrypted, wrong passphrase or key file, or the file was altered")
+	}
+	return plain, nil
+}
+
+func (c *backupCipher) aead(kdf byte, salt []byte, iterations uint32) (cipher.AEAD, error) {
+	key, err := c.key(kdf, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptBackup writes the encrypted copy of a plain snapshot at path. The snapshot is
+// expected outside the backup directory, the backup only shows up once complete.
+func (s *server) encryptBackup(snapshot string, path string) error {
+	plain, err := os.ReadFile(snapshot)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.cipher.Encrypt(plain)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// openBackup returns the path of a readable copy of a backup: the backup itself when it
+// is a plain database, a decrypted and decompressed copy for downloaded backups.
+// cleanup removes the copy.
+func (s *server) openBackup(path string) (plainPath string, cleanup func(), err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	plain := data
+	unpacked := false
+	if isEncryptedBackup(plain) {
+		unpacked = true
+		plain, err = s.cipher.Decrypt(plain)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	compressed := bytes.HasPrefix(plain, []byte{0x1f, 0x8b})
+	if !unpacked && !compressed {
+		return path, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "gomarks-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	plainPath = filepath.Join(dir, filepath.Base(path))
+	if err := writeUnpacked(plainPath, plain, compressed); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return plainPath, cleanup, nil
+}
+
+// writeUnpacked writes a backup to path, decompressing it on the way when compressed.
+func writeUnpacked(path string, data []byte, compressed bool) error {
+	if !compressed {
+		return os.WriteFile(path, data, 0600)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, io.LimitReader(zr, maxUnpackedBackupSize+1))
+	if err != nil {
+		return err
+	}
+	if n > maxUnpackedBackupSize {
+		return fmt.Errorf("backup is larger than %s once decompressed", formatSize(maxUnpackedBackupSize))
+	}
+	return f.Close()
+}
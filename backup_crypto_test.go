@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestKeyFile(t *testing.T, key []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "backup.key")
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewBackupCipher(t *testing.T) {
+	c, err := newBackupCipher(config{})
+	if err != nil || c != nil {
+		t.Errorf("cipher without passphrase or key = %v, %v, want nil", c, err)
+	}
+	if _, err := newBackupCipher(config{BackupKeyFile: newTestKeyFile(t, []byte("short"))}); err == nil {
+		t.Error("a 5 byte key file was accepted")
+	}
+	if _, err := newBackupCipher(config{BackupKeyFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("a missing key file was accepted")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	plain := []byte("SQLite format 3\x00 and some links")
+	keyFile := newTestKeyFile(t, bytes.Repeat([]byte{7}, 32))
+
+	for _, cfg := range []config{
+		{BackupPassphrase: "correct horse battery staple"},
+		{BackupKeyFile: keyFile},
+	} {
+		c, err := newBackupCipher(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed, err := c.Encrypt(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isEncryptedBackup(sealed) || bytes.Contains(sealed, []byte("links")) {
+			t.Errorf("sealed backup starts with %q and holds the plain text", sealed[:4])
+		}
+		opened, err := c.Decrypt(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(opened, plain) {
+			t.Errorf("decrypted %q, want %q", opened, plain)
+		}
+
+		// Salt and nonce are fresh every time
+		again, err := c.Encrypt(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(again, sealed) {
+			t.Error("the same backup was sealed twice the same way")
+		}
+	}
+}
+
+func TestDecryptRefuses(t *testing.T) {
+	c, err := newBackupCipher(config{BackupPassphrase: "right"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := c.Encrypt([]byte("links"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong, err := newBackupCipher(config{BackupPassphrase: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyOnly, err := newBackupCipher(config{BackupKeyFile: newTestKeyFile(t, bytes.Repeat([]byte{1}, 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	altered := append([]byte(nil), sealed...)
+	altered[len(altered)-1] ^= 1
+	header := append([]byte(nil), sealed...)
+	header[22] = 0xff // PBKDF2 iterations
+
+	for _, test := range []struct {
+		name   string
+		cipher *backupCipher
+		data   []byte
+		error  string
+	}{
+		{"wrong passphrase", wrong, sealed, "wrong passphrase"},
+		{"altered content", c, altered, "altered"},
+		{"too many iterations", c, header, "iterations"},
+		{"no passphrase", nil, sealed, "-backup-passphrase"},
+		{"key file only", keyOnly, sealed, "-backup-passphrase"},
+		{"plain database", c, []byte("SQLite format 3\x00"), "not an encrypted backup"},
+	} {
+		_, err := test.cipher.Decrypt(test.data)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: Decrypt returned %v, want an error about %q", test.name, err, test.error)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// dailyBackups returns a backup at noon on each of the days before the first, newest first.
+func dailyBackups(first time.Time, days int) []backupFile {
+	var backups []backupFile
+	for i := 0; i < days; i++ {
+		taken := first.AddDate(0, 0, -i)
+		backups = append(backups, backupFile{Name: "items.db." + taken.Format(backupTimestampLayout), Time: taken})
+	}
+	return backups
+}
+
+func TestRetainedBackups(t *testing.T) {
+	// Monday the 15th of January 2024, at noon
+	monday := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	backups := dailyBackups(monday, 30)
+
+	keep := retainedBackups(backups, 7, 4)
+	var kept []string
+	for _, backup := range backups {
+		if keep[backup.Name] {
+			kept = append(kept, backup.Time.Format("01-02"))
+		}
+	}
+	// The last 7 days, then the newest backup of each of the 4 newest weeks
+	want := []string{"01-15", "01-14", "01-13", "01-12", "01-11", "01-10", "01-09", "01-07", "12-31"}
+	if fmt.Sprint(kept) != fmt.Sprint(want) {
+		t.Errorf("kept %v, want %v", kept, want)
+	}
+}
+
+func TestRetainedBackupsKeepsNewest(t *testing.T) {
+	backups := dailyBackups(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), 3)
+	keep := retainedBackups(backups, 0, 0)
+	if len(keep) != 1 || !keep[backups[0].Name] {
+		t.Errorf("kept %v, want only %s", keep, backups[0].Name)
+	}
+
+	// Two backups the same day count as one day, the newest of them is kept
+	noon := backups[0].Time
+	sameDay := []backupFile{
+		{Name: "items.db.20240115_180000", Time: noon.Add(6 * time.Hour)},
+		{Name: "items.db.20240115_120000", Time: noon},
+		{Name: "items.db.20240114_120000", Time: noon.AddDate(0, 0, -1)},
+	}
+	keep = retainedBackups(sameDay, 2, 0)
+	if !keep[sameDay[0].Name] || keep[sameDay[1].Name] || !keep[sameDay[2].Name] {
+		t.Errorf("kept %v, want the 18:00 backup and the one of the day before", keep)
+	}
+}
+
+func TestRetainedBackupsIgnoresUploads(t *testing.T) {
+	// An upload named after the evening it was uploaded, over the backup taken that morning
+	backups := []backupFile{
+		{Name: "items.db.20240115_180000" + uploadSuffix, Time: time.Date(2024, 1, 15, 18, 0, 0, 0, time.UTC), Uploaded: true},
+		{Name: "items.db.20240115_090000", Time: time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{Name: "items.db.20240114_090000", Time: time.Date(2024, 1, 14, 9, 0, 0, 0, time.UTC)},
+	}
+	keep := retainedBackups(backups, 1, 0)
+	if len(keep) != 2 || !keep[backups[0].Name] || !keep[backups[1].Name] {
+		t.Errorf("kept %v, want the upload and the backup of the 15th", keep)
+	}
+}
+
+func TestDiffLinks(t *testing.T) {
+	current := []Link{
+		{Name: "gh", URL: "https://github.com"},
+		{Name: "gl", URL: "https://gitlab.com"},
+		{Name: "docker", URL: "https://hub.docker.com/_/%s", Singleword: 1},
+		{Name: "amzn", URL: "https://www.amazon.com/s?k=%s"},
+		{Name: "pr", URL: "https://github.com/pulls/%s", ArgType: "integer"},
+	}
+	restored := []Link{
+		{Name: "gh", URL: "https://github.com", Count: 12},
+		{Name: "docker", URL: "https://hub.docker.com/_/%s"},
+		{Name: "amzn", URL: "https://www.amazon.fr/s?k=%s"},
+		{Name: "ji", URL: "https://jira.example.com/browse/%s"},
+		{Name: "pr", URL: "https://github.com/pulls/%s"},
+	}
+
+	diff := diffLinks(current, restored)
+	if fmt.Sprint(diff.Added) != "[ji]" {
+		t.Errorf("added %v, want [ji]", diff.Added)
+	}
+	if fmt.Sprint(diff.Removed) != "[gl]" {
+		t.Errorf("removed %v, want [gl]", diff.Removed)
+	}
+	// Counts don't make a link different, argument constraints do
+	if fmt.Sprint(diff.Changed) != "[docker amzn pr]" {
+		t.Errorf("changed %v, want [docker amzn pr]", diff.Changed)
+	}
+
+	if diff := diffLinks(current, current); len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 {
+		t.Errorf("diff of identical links = %+v", diff)
+	}
+}
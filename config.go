@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// config holds the startup settings. Each one can be set, from lowest to highest
+// priority, in a config file, in an environment variable or with a command line flag.
+type config struct {
+	DB          string // path of the SQLite database
+	DSN         string // PostgreSQL connection string, SQLite is used when empty
+	BackupDir   string // where backups are written, next to the database when empty
+	Listen      string
+	Static      string
+	MigrateOnly bool
+
+	// Import of a file from the command line, instead of serving
+	Import       string
+	ImportPolicy string
+	ImportDryRun bool
+
+	// Offsite copies of the backups, credentials only come from the environment
+	S3Endpoint string
+	S3Bucket   string
+	S3Prefix   string
+	S3Region   string
+
+	// Encryption of the backups
+	BackupPassphrase string
+	BackupKeyFile    string
+}
+
+// configOptions maps the config file keys to their environment variable and flag.
+var configOptions = []struct {
+	key   string
+	env   string
+	usage string
+	field func(c *config) *string
+}{
+	{"db", "GOMARKS_DB", "path of the SQLite database", func(c *config) *string { return &c.DB }},
+	{"dsn", "GOMARKS_DSN", "PostgreSQL connection string, SQLite is used when empty", func(c *config) *string { return &c.DSN }},
+	{"backup-dir", "GOMARKS_BACKUP_DIR", "directory for backups, defaults to the directory of the database", func(c *config) *string { return &c.BackupDir }},
+	{"listen", "GOMARKS_LISTEN", "address to listen on", func(c *config) *string { return &c.Listen }},
+	{"static", "GOMARKS_STATIC", "directory of the static files", func(c *config) *string { return &c.Static }},
+	{"s3-endpoint", "GOMARKS_S3_ENDPOINT", "URL of the S3-compatible storage for offsite backups", func(c *config) *string { return &c.S3Endpoint }},
+	{"s3-bucket", "GOMARKS_S3_BUCKET", "bucket for offsite backups, disabled when empty", func(c *config) *string { return &c.S3Bucket }},
+	{"s3-prefix", "GOMARKS_S3_PREFIX", "prefix of the offsite backup names, like gomarks/", func(c *config) *string { return &c.S3Prefix }},
+	{"s3-region", "GOMARKS_S3_REGION", "region of the S3 bucket", func(c *config) *string { return &c.S3Region }},
+	{"backup-passphrase", "GOMARKS_BACKUP_PASSPHRASE", "encrypt backups with this passphrase", func(c *config) *string { return &c.BackupPassphrase }},
+	{"backup-key-file", "GOMARKS_BACKUP_KEY_FILE", "encrypt backups with the key in this file, at least 32 random bytes", func(c *config) *string { return &c.BackupKeyFile }},
+}
+
+// loadConfig builds the config from the defaults, the config file, the environment and
+// the command line arguments.
+func loadConfig(args []string) (config, error) {
+	c := config{
+		DB:     "/data/items.db",
+		Listen: ":8080",
+		Static: "./static",
+
+		S3Endpoint: "https://s3.amazonaws.com",
+		S3Region:   "us-east-1",
+	}
+
+	flags := flag.NewFlagSet("gomarks", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("GOMARKS_CONFIG"), "config file with key = value lines (env GOMARKS_CONFIG)")
+	flags.BoolVar(&c.MigrateOnly, "migrate-only", false, "upgrade the database schema and exit without serving")
+	flags.StringVar(&c.Import, "import", "", "import links from an export, CSV, bookmark file, or Chrome \"Web Data\" or Firefox places.sqlite file, and exit without serving")
+	flags.StringVar(&c.ImportPolicy, "import-policy", policySkip, "what -import does with keywords that exist with another URL: skip, overwrite, rename or merge")
+	flags.BoolVar(&c.ImportDryRun, "import-dry-run", false, "only show what -import would change")
+	values := make(map[string]*string)
+	for _, option := range configOptions {
+		values[option.key] = flags.String(option.key, *option.field(&c), fmt.Sprintf("%s (env %s)", option.usage, option.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return c, err
+	}
+
+	if *configFile != "" {
+		if err := c.readFile(*configFile); err != nil {
+			return c, err
+		}
+	}
+
+	for _, option := range configOptions {
+		if value, ok := os.LookupEnv(option.env); ok {
+			*option.field(&c) = value
+		}
+	}
+
+	// Only the flags given on the command line override the other sources
+	flags.Visit(func(f *flag.Flag) {
+		for _, option := range configOptions {
+			if option.key == f.Name {
+				*option.field(&c) = *values[option.key]
+			}
+		}
+	})
+
+	if c.BackupDir == "" {
+		c.BackupDir = filepath.Dir(c.DB)
+	}
+	return c, nil
+}
+
+// readFile reads a config file made of "key = value" lines. Blank lines and lines
+// starting with # are ignored, keys are the names of the flags.
+func (c *config) readFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(text, "=")
+		if !found {
+			return fmt.Errorf("%s:%d: expected key = value", path, line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		known := false
+		for _, option := range configOptions {
+			if option.key == key {
+				*option.field(c) = value
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, line, key)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,714 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Every import is previewed first: the file is read and kept aside, the user sees what it
+// would change and picks what happens to conflicting keywords, then it is applied in a
+// single transaction.
+
+// importRow is a link read from an import file. Row is its position in the file, for
+// the report, and err what made it unreadable.
+type importRow struct {
+	Row  int
+	Link Link
+	err  error
+}
+
+// importIssue is an entry of an import that was left out, and why.
+type importIssue struct {
+	Row    int    `json:"row"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// importConflict is an imported link whose keyword exists with another URL.
+type importConflict struct {
+	Row         int    `json:"row"`
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ExistingURL string `json:"existing_url"`
+	link        Link
+	existing    Link
+}
+
+// Policies for conflicting keywords
+const (
+	policySkip      = "skip"
+	policyOverwrite = "overwrite"
+	policyRename    = "rename"
+	policyMerge     = "merge"
+)
+
+var importPolicies = []struct {
+	Value string
+	Label string
+}{
+	{policySkip, "Skip: keep the existing link"},
+	{policyOverwrite, "Overwrite: replace the existing link, counter included"},
+	{policyRename, "Keep both: import under a new keyword"},
+	{policyMerge, "Merge counts: keep the existing link, add the imported visits"},
+}
+
+func validPolicy(policy string) bool {
+	for _, p := range importPolicies {
+		if p.Value == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// importPreview sorts what an import holds against the current links.
+type importPreview struct {
+	Token     string            `json:"token"`
+	New       []string          `json:"new"`
+	Identical []string          `json:"identical"`
+	Conflicts []importConflict  `json:"conflicts"`
+	Invalid   []importIssue     `json:"invalid"`
+	Settings  map[string]string `json:"settings"`
+	Variables map[string]string `json:"variables"`
+
+	add      []Link
+	previous map[string]string // values of the changed settings before the import
+}
+
+// importReport tells what an import changed.
+type importReport struct {
+	Added       []string      `json:"added"`
+	Overwritten []string      `json:"overwritten"`
+	Renamed     []string      `json:"renamed"`
+	Merged      []string      `json:"merged"`
+	Unchanged   int           `json:"unchanged"`
+	Skipped     []importIssue `json:"skipped"`
+	Settings    []string      `json:"settings"`
+	Variables   []string      `json:"variables"`
+}
+
+// pendingImport is a file read and waiting for the user to review its preview.
+type pendingImport struct {
+	rows      []importRow
+	settings  map[string]string
+	variables map[string]string
+	created   time.Time
+}
+
+// pendingImports keeps the previewed imports until they are applied, for an hour at most.
+type pendingImports struct {
+	mu      sync.Mutex
+	imports map[string]pendingImport
+}
+
+func newPendingImports() *pendingImports {
+	return &pendingImports{imports: make(map[string]pendingImport)}
+}
+
+func (p *pendingImports) add(pending pendingImport) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for t, old := range p.imports {
+		if time.Since(old.created) > time.Hour {
+			delete(p.imports, t)
+		}
+	}
+	pending.created = time.Now()
+	p.imports[token] = pending
+	return token, nil
+}
+
+func (p *pendingImports) get(token string) (pendingImport, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pending, ok := p.imports[token]
+	return pending, ok && time.Since(pending.created) <= time.Hour
+}
+
+func (p *pendingImports) remove(token string) {
+	p.mu.Lock()
+	delete(p.imports, token)
+	p.mu.Unlock()
+}
+
+// previewImport sorts the links of an import into new, identical, conflicting and invalid
+// ones, the latter being the ones the add form would refuse, and lists the settings and
+// variables it changes.
+func (s *server) previewImport(pending pendingImport) (importPreview, error) {
+	preview := importPreview{
+		New:       []string{},
+		Identical: []string{},
+		Conflicts: []importConflict{},
+		Invalid:   []importIssue{},
+		Settings:  make(map[string]string),
+		Variables: make(map[string]string),
+		previous:  make(map[string]string),
+	}
+
+	reserved, err := s.reservedKeywords()
+	if err != nil {
+		return preview, err
+	}
+	vars, err := s.store.Variables()
+	if err != nil {
+		return preview, err
+	}
+	links, err := s.store.ListLinks()
+	if err != nil {
+		return preview, err
+	}
+	existing := make(map[string]Link)
+	for _, link := range links {
+		existing[strings.ToLower(link.Name)] = link
+	}
+
+	// Links may use the variables imported along with them
+	allVars := make(map[string]string)
+	for name, value := range vars {
+		allVars[name] = value
+	}
+	for name, value := range pending.variables {
+		if !variableName.MatchString(name) || value == "" {
+			preview.Invalid = append(preview.Invalid, importIssue{Name: "${" + name + "}", Reason: "Variable names can only contain letters, digits and underscores, and values cannot be empty."})
+			continue
+		}
+		allVars[name] = value
+		if vars[name] != value {
+			preview.Variables[name] = value
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, row := range pending.rows {
+		link := row.Link
+		invalid := func(reason string) {
+			preview.Invalid = append(preview.Invalid, importIssue{row.Row, link.Name, reason})
+		}
+
+		if row.err != nil {
+			invalid(row.err.Error())
+			continue
+		}
+		if err := validateLink(link, reserved, allVars); err != nil {
+			invalid(err.Error())
+			continue
+		}
+		if seen[strings.ToLower(link.Name)] {
+			invalid("This keyword appears earlier in the file.")
+			continue
+		}
+		seen[strings.ToLower(link.Name)] = true
+
+		current, exists := existing[strings.ToLower(link.Name)]
+		switch {
+		case !exists:
+			preview.New = append(preview.New, link.Name)
+			preview.add = append(preview.add, link)
+		case current.URL == link.URL:
+			preview.Identical = append(preview.Identical, link.Name)
+		default:
+			preview.Conflicts = append(preview.Conflicts, importConflict{row.Row, link.Name, link.URL, current.URL, link, current})
+		}
+	}
+
+	settings, err := s.store.Settings()
+	if err != nil {
+		return preview, err
+	}
+	// Settings are checked like their forms do, against the values they will all have
+	imported := make(map[string]string)
+	for setting, value := range settings {
+		imported[setting] = value
+	}
+	for setting, value := range pending.settings {
+		if setting == "trusted_domains" {
+			value = strings.Join(parseTrustedDomains(value), "\n")
+		}
+		imported[setting] = value
+	}
+	for setting := range pending.settings {
+		current, known := settings[setting]
+		if !known || strings.HasPrefix(setting, variablePrefix) {
+			preview.Invalid = append(preview.Invalid, importIssue{Name: setting, Reason: "Unknown setting."})
+			continue
+		}
+		value := imported[setting]
+		if current == value {
+			continue
+		}
+		if err := s.validateSetting(setting, value, imported); err != nil {
+			preview.Invalid = append(preview.Invalid, importIssue{Name: setting, Reason: err.Error()})
+			continue
+		}
+		preview.Settings[setting] = value
+		preview.previous[setting] = current
+	}
+	return preview, nil
+}
+
+// planImport turns a preview into the changes to make, conflicts being resolved by their
+// own policy in choices, by row, or else by the global policy.
+func (s *server) planImport(preview importPreview, policy string, choices map[int]string) (ImportPlan, importReport, error) {
+	plan := ImportPlan{Add: preview.add, AddCounts: make(map[string]int), Settings: preview.Settings, Variables: preview.Variables}
+	report := importReport{
+		Added:       append([]string{}, preview.New...),
+		Overwritten: []string{},
+		Renamed:     []string{},
+		Merged:      []string{},
+		Unchanged:   len(preview.Identical),
+		Skipped:     append([]importIssue{}, preview.Invalid...),
+		Settings:    []string{},
+		Variables:   []string{},
+	}
+
+	// Keywords given to renamed links can't be any of the imported ones either
+	planned := make(map[string]bool)
+	for _, name := range preview.New {
+		planned[strings.ToLower(name)] = true
+	}
+
+	for _, conflict := range preview.Conflicts {
+		choice := policy
+		if c := choices[conflict.Row]; c != "" {
+			choice = c
+		}
+
+		switch choice {
+		case policyOverwrite:
+			link := conflict.link
+			link.Name = conflict.existing.Name
+			if link.UpdatedAt.IsZero() {
+				link.UpdatedAt = time.Now()
+			}
+			plan.Replace = append(plan.Replace, link)
+			report.Overwritten = append(report.Overwritten, link.Name)
+		case policyRename:
+			name, err := s.freeKeyword(conflict.Name, planned)
+			if err != nil {
+				return plan, report, err
+			}
+			planned[strings.ToLower(name)] = true
+			link := conflict.link
+			link.Name = name
+			plan.Add = append(plan.Add, link)
+			report.Renamed = append(report.Renamed, conflict.Name+" → "+name)
+		case policyMerge:
+			plan.AddCounts[conflict.existing.Name] += conflict.link.Count
+			report.Merged = append(report.Merged, conflict.existing.Name)
+		default:
+			report.Skipped = append(report.Skipped, importIssue{conflict.Row, conflict.Name, "The keyword exists with another URL, the existing link was kept."})
+		}
+	}
+
+	for setting := range plan.Settings {
+		report.Settings = append(report.Settings, setting)
+	}
+	for name := range plan.Variables {
+		report.Variables = append(report.Variables, name)
+	}
+	sort.Strings(report.Settings)
+	sort.Strings(report.Variables)
+	return plan, report, nil
+}
+
+// freeKeyword returns the first of name-2, name-3... that nothing uses.
+func (s *server) freeKeyword(name string, planned map[string]bool) (string, error) {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", name, i)
+		if planned[strings.ToLower(candidate)] {
+			continue
+		}
+		taken, err := s.store.KeywordTaken(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
+
+// readImport reads the uploaded file of an import form.
+func readImport(r *http.Request) (pendingImport, error) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return pendingImport{}, fmt.Errorf("no file uploaded")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return pendingImport{}, err
+	}
+
+	mapping := make(map[string]string)
+	for _, column := range csvColumns {
+		mapping[column.field] = r.FormValue("column_" + column.field)
+	}
+	return readImportFile(header.Filename, header.Header.Get("Content-Type"), data, mapping)
+}
+
+// readImportFile reads a file to import: a browser profile database, a bookmark file, a
+// CSV file with its columns mapped, or else a JSON or YAML export.
+func readImportFile(name string, contentType string, data []byte, mapping map[string]string) (pendingImport, error) {
+	var pending pendingImport
+	var err error
+
+	// Browser files and spreadsheets only hold links, exports hold settings and variables too
+	if isSQLiteFile(data) {
+		pending.rows, err = readBrowserKeywords(data)
+		return pending, err
+	}
+	if isBookmarksFile(data) {
+		pending.rows, err = readBookmarks(data)
+		return pending, err
+	}
+	if strings.HasSuffix(strings.ToLower(name), ".csv") || contentType == "text/csv" {
+		pending.rows, err = readCSV(data, mapping)
+		return pending, err
+	}
+
+	export, err := parseExport(data)
+	if err != nil {
+		return pending, err
+	}
+	pending.rows = export.rows()
+	pending.settings = export.Settings
+	pending.variables = export.Variables
+	return pending, nil
+}
+
+// handleImportPost reads an import and shows its preview. API clients can apply it right
+// away with apply=1 and a policy for all conflicts.
+func (s *server) handleImportPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	pending, err := readImport(r)
+	if err != nil {
+		http.Error(w, "This file can't be imported: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("apply") != "" {
+		s.applyImport(w, r, pending)
+		return
+	}
+
+	preview, err := s.previewImport(pending)
+	if err != nil {
+		http.Error(w, "Failed to prepare the import.", http.StatusInternalServerError)
+		return
+	}
+	preview.Token, err = s.imports.add(pending)
+	if err != nil {
+		http.Error(w, "Failed to prepare the import.", http.StatusInternalServerError)
+		return
+	}
+	renderImportPreview(w, r, preview)
+}
+
+// handleImportApply applies a previewed import with the policies picked for its conflicts.
+func (s *server) handleImportApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.FormValue("token")
+	pending, ok := s.imports.get(token)
+	if !ok {
+		http.Error(w, "This import has expired, upload the file again.", http.StatusNotFound)
+		return
+	}
+	if s.applyImport(w, r, pending) {
+		s.imports.remove(token)
+	}
+}
+
+// applyImport plans an import against the current links, which may have changed since its
+// preview, applies it and answers with the report.
+func (s *server) applyImport(w http.ResponseWriter, r *http.Request, pending pendingImport) bool {
+	policy := r.FormValue("policy")
+	if policy == "" {
+		policy = policySkip
+	}
+	if !validPolicy(policy) {
+		http.Error(w, "Unknown conflict policy, use skip, overwrite, rename or merge.", http.StatusBadRequest)
+		return false
+	}
+	choices := make(map[int]string)
+	for key, values := range r.Form {
+		row, found := strings.CutPrefix(key, "policy_")
+		if !found || len(values) == 0 || values[0] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(row)
+		if err != nil || !validPolicy(values[0]) {
+			http.Error(w, "Unknown conflict policy, use skip, overwrite, rename or merge.", http.StatusBadRequest)
+			return false
+		}
+		choices[n] = values[0]
+	}
+
+	preview, err := s.previewImport(pending)
+	if err != nil {
+		http.Error(w, "Failed to prepare the import.", http.StatusInternalServerError)
+		return false
+	}
+	plan, report, err := s.planImport(preview, policy, choices)
+	if err != nil {
+		http.Error(w, "Failed to prepare the import.", http.StatusInternalServerError)
+		return false
+	}
+
+	// All or nothing
+	err = s.store.ApplyImport(plan, getActor(r))
+	if err != nil {
+		http.Error(w, "Import failed, nothing was imported: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	s.audit(r, "import", "", "", report.String())
+	for _, setting := range report.Settings {
+		s.audit(r, "setting.update", setting, preview.previous[setting], plan.Settings[setting])
+	}
+
+	renderImportReport(w, r, report)
+	return true
+}
+
+// String sums up the report, for the audit log.
+func (report importReport) String() string {
+	return fmt.Sprintf("%d links added, %d overwritten, %d renamed, %d merged, %d skipped, %d settings and %d variables changed",
+		len(report.Added), len(report.Overwritten), len(report.Renamed), len(report.Merged), len(report.Skipped), len(report.Settings), len(report.Variables))
+}
+
+// importFile imports a file from the command line, resolving all conflicts with policy,
+// and logs its preview or report. A dry run only logs the preview.
+func (s *server) importFile(path string, policy string, dryRun bool) error {
+	if !validPolicy(policy) {
+		return fmt.Errorf("unknown import policy %q, use skip, overwrite, rename or merge", policy)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pending, err := readImportFile(path, "", data, nil)
+	if err != nil {
+		return fmt.Errorf("%s can't be imported: %w", path, err)
+	}
+
+	preview, err := s.previewImport(pending)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s holds %d new links, %d identical to existing ones, %d conflicting and %d invalid",
+		path, len(preview.New), len(preview.Identical), len(preview.Conflicts), len(preview.Invalid))
+	for _, conflict := range preview.Conflicts {
+		log.Printf("Conflict on row %d: %s is %s here and %s in the file", conflict.Row, conflict.Name, conflict.ExistingURL, conflict.URL)
+	}
+	for _, issue := range preview.Invalid {
+		log.Printf("Invalid row %d: %s: %s", issue.Row, issue.Name, issue.Reason)
+	}
+	if dryRun {
+		log.Printf("Dry run, nothing was imported")
+		return nil
+	}
+
+	plan, report, err := s.planImport(preview, policy, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.store.ApplyImport(plan, importActor); err != nil {
+		return fmt.Errorf("import failed, nothing was imported: %w", err)
+	}
+	err = s.store.AddAuditEntry(AuditEntry{CreatedAt: time.Now(), Actor: importActor, Action: "import", Target: path, After: report.String()})
+	for _, setting := range report.Settings {
+		if err == nil {
+			err = s.store.AddAuditEntry(AuditEntry{CreatedAt: time.Now(), Actor: importActor, Action: "setting.update", Target: setting, Before: preview.previous[setting], After: plan.Settings[setting]})
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to record the import in the audit log: %v", err)
+	}
+	for _, renamed := range report.Renamed {
+		log.Printf("Imported under a new keyword: %s", renamed)
+	}
+	log.Printf("Imported %s: %s", path, report)
+	return nil
+}
+
+// importActor is who imports from the command line, in revisions and the audit log.
+const importActor = "command line"
+
+// wantsJSON reports whether an API client asked for a JSON answer.
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func renderImportPreview(w http.ResponseWriter, r *http.Request, preview importPreview) {
+	if wantsJSON(r) {
+		writeJSON(w, preview)
+		return
+	}
+
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	</head>
+	<body>
+		<h2><a href="/">Import preview</a></h2>
+		Nothing is imported yet. {{len .New}} new links, {{len .Identical}} identical to existing ones, {{len .Conflicts}} conflicting, {{len .Invalid}} invalid.</p>
+		{{if .New}}New: {{range $i, $name := .New}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</p>{{end}}
+		{{if .Identical}}Identical, left as they are: {{range $i, $name := .Identical}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</p>{{end}}
+		{{if .Settings}}Settings changed: {{range $name, $value := .Settings}}<code>{{$name}}</code> {{end}}</p>{{end}}
+		{{if .Variables}}Variables added or changed: {{range $name, $value := .Variables}}<code>{{$name}}</code> {{end}}</p>{{end}}
+
+		<form action="/import-apply" method="post">
+			<input type="hidden" name="token" value="{{.Token}}">
+			{{if .Conflicts}}
+			<h2>Conflicts</h2>
+			<table class="links">
+				<tr>
+					<th style="text-align: center; width: 60px">Row</th>
+					<th style="text-align: left; width: 150px">Keyword</th>
+					<th style="text-align: left;">Existing URL</th>
+					<th style="text-align: left;">Imported URL</th>
+					<th style="text-align: left; width: 200px">Policy</th>
+				</tr>
+				{{range .Conflicts}}
+				<tr>
+					<td style="text-align: center;">{{.Row}}</td>
+					<td><code>{{.Name}}</code></td>
+					<td>{{.ExistingURL}}</td>
+					<td>{{.URL}}</td>
+					<td>
+						<select name="policy_{{.Row}}">
+							<option value="">Like the others</option>
+							{{range $.Policies}}<option value="{{.Value}}">{{.Label}}</option>{{end}}
+						</select>
+					</td>
+				</tr>
+				{{end}}
+			</table>
+			</p>
+			<label for="policy">For the other conflicts</label>
+			<select name="policy" id="policy">
+				{{range .Policies}}<option value="{{.Value}}">{{.Label}}</option>{{end}}
+			</select></p>
+			{{end}}
+			<button type="submit">Import</button></p>
+			<button type="button" onclick="window.location.href = '/import/'">Cancel</button>
+		</form>
+
+		{{if .Invalid}}
+		<h2>Invalid, left out</h2>
+		<table class="links">
+			<tr>
+				<th style="text-align: center; width: 60px">Row</th>
+				<th style="text-align: left; width: 200px">Entry</th>
+				<th style="text-align: left;">Reason</th>
+			</tr>
+			{{range .Invalid}}
+			<tr>
+				<td style="text-align: center;">{{if .Row}}{{.Row}}{{end}}</td>
+				<td><code>{{.Name}}</code></td>
+				<td>{{.Reason}}</td>
+			</tr>
+			{{end}}
+		</table>
+		{{end}}
+		The import is applied in one go: if anything fails, nothing is imported.
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("preview").Parse(tmpl))
+	tmplParsed.Execute(w, struct {
+		importPreview
+		Policies any
+	}{preview, importPolicies})
+}
+
+// renderImportReport answers an import with its report, in JSON for API clients asking for it.
+func renderImportReport(w http.ResponseWriter, r *http.Request, report importReport) {
+	if wantsJSON(r) {
+		writeJSON(w, report)
+		return
+	}
+
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	</head>
+	<body>
+		<h2><a href="/">Import done</a></h2>
+		{{len .Added}} links added, {{len .Overwritten}} overwritten, {{len .Renamed}} renamed, {{len .Merged}} merged, {{.Unchanged}} unchanged, {{len .Skipped}} entries skipped.</p>
+		{{if .Added}}Added: {{range $i, $name := .Added}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</p>{{end}}
+		{{if .Overwritten}}Overwritten: {{range $i, $name := .Overwritten}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</p>{{end}}
+		{{if .Renamed}}Imported under a new keyword: {{range $i, $name := .Renamed}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</p>{{end}}
+		{{if .Merged}}Counts merged into: {{range $i, $name := .Merged}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</p>{{end}}
+		{{if .Settings}}Settings changed: {{range $i, $name := .Settings}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</p>{{end}}
+		{{if .Variables}}Variables added or changed: {{range $i, $name := .Variables}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</p>{{end}}
+		{{if .Skipped}}
+		<table class="links">
+			<tr>
+				<th style="text-align: center; width: 60px">Row</th>
+				<th style="text-align: left; width: 200px">Entry</th>
+				<th style="text-align: left;">Skipped because</th>
+			</tr>
+			{{range .Skipped}}
+			<tr>
+				<td style="text-align: center;">{{if .Row}}{{.Row}}{{end}}</td>
+				<td><code>{{.Name}}</code></td>
+				<td>{{.Reason}}</td>
+			</tr>
+			{{end}}
+		</table>
+		{{end}}
+		</p>
+		<button onclick="window.location.href = '/'">Back</button>
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("report").Parse(tmpl))
+	tmplParsed.Execute(w, report)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// importConflicts returns a server holding gh and docker, and an import in conflict
+// with both of them, adding ji along the way.
+func importConflicts(t *testing.T) (*server, pendingImport) {
+	t.Helper()
+	s := newTestServer(t,
+		Link{Name: "gh", URL: "https://github.com"},
+		Link{Name: "docker", URL: "https://hub.docker.com/_/%s", Singleword: 1},
+		Link{Name: "gh-2", URL: "https://github.com/2"},
+	)
+	for i := 0; i < 3; i++ {
+		s.store.IncrementCount("gh")
+	}
+	pending := pendingImport{rows: []importRow{
+		{Row: 1, Link: Link{Name: "GH", URL: "https://gitlab.com", Count: 5}},
+		{Row: 2, Link: Link{Name: "docker", URL: "https://hub.docker.com/r/%s", Count: 2}},
+		{Row: 3, Link: Link{Name: "ji", URL: "https://jira.example.com/browse/%s"}},
+		{Row: 4, Link: Link{Name: "gh-3", URL: "https://github.com/3"}},
+	}}
+	return s, pending
+}
+
+// runImport previews, plans and applies an import.
+func runImport(t *testing.T, s *server, pending pendingImport, policy string, choices map[int]string) importReport {
+	t.Helper()
+	preview, err := s.previewImport(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Conflicts) != 2 || fmt.Sprint(preview.New) != "[ji gh-3]" {
+		t.Fatalf("preview has conflicts %v and new links %v", preview.Conflicts, preview.New)
+	}
+	plan, report, err := s.planImport(preview, policy, choices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.store.ApplyImport(plan, "ann"); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func linkState(t *testing.T, s *server, name string) string {
+	t.Helper()
+	link, err := s.store.GetLink(name)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("%s %s %d", link.Name, link.URL, link.Count)
+}
+
+func TestImportSkip(t *testing.T) {
+	s, pending := importConflicts(t)
+	report := runImport(t, s, pending, policySkip, nil)
+
+	if len(report.Skipped) != 2 || fmt.Sprint(report.Added) != "[ji gh-3]" {
+		t.Errorf("report = %+v", report)
+	}
+	if got := linkState(t, s, "gh"); got != "gh https://github.com 3" {
+		t.Errorf("gh = %s", got)
+	}
+	if got := linkState(t, s, "ji"); got != "ji https://jira.example.com/browse/%s 0" {
+		t.Errorf("ji = %s", got)
+	}
+}
+
+func TestImportOverwrite(t *testing.T) {
+	s, pending := importConflicts(t)
+	report := runImport(t, s, pending, policyOverwrite, nil)
+
+	// The existing keyword keeps its case, the counter comes from the file
+	if fmt.Sprint(report.Overwritten) != "[gh docker]" {
+		t.Errorf("overwritten %v", report.Overwritten)
+	}
+	if got := linkState(t, s, "gh"); got != "gh https://gitlab.com 5" {
+		t.Errorf("gh = %s", got)
+	}
+	link, err := s.store.GetLink("gh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := s.store.LinkRevisions(link.ID)
+	if err != nil || len(revisions) != 2 || revisions[0].Action != "import" {
+		t.Errorf("revisions = %v, %v, want an import on top of the creation", revisions, err)
+	}
+}
+
+func TestImportRename(t *testing.T) {
+	s, pending := importConflicts(t)
+	report := runImport(t, s, pending, policyRename, nil)
+
+	// gh-2 exists and gh-3 comes with the file, so the imported GH becomes GH-4
+	if fmt.Sprint(report.Renamed) != "[GH → GH-4 docker → docker-2]" {
+		t.Errorf("renamed %v", report.Renamed)
+	}
+	if got := linkState(t, s, "gh"); got != "gh https://github.com 3" {
+		t.Errorf("gh = %s", got)
+	}
+	if got := linkState(t, s, "gh-4"); got != "GH-4 https://gitlab.com 5" {
+		t.Errorf("gh-4 = %s", got)
+	}
+	if got := linkState(t, s, "docker-2"); got != "docker-2 https://hub.docker.com/r/%s 2" {
+		t.Errorf("docker-2 = %s", got)
+	}
+}
+
+func TestImportMerge(t *testing.T) {
+	s, pending := importConflicts(t)
+	report := runImport(t, s, pending, policyMerge, nil)
+
+	if fmt.Sprint(report.Merged) != "[gh docker]" {
+		t.Errorf("merged %v", report.Merged)
+	}
+	if got := linkState(t, s, "gh"); got != "gh https://github.com 8" {
+		t.Errorf("gh = %s", got)
+	}
+	if got := linkState(t, s, "docker"); got != "docker https://hub.docker.com/_/%s 2" {
+		t.Errorf("docker = %s", got)
+	}
+}
+
+func TestImportChoicesWinOverPolicy(t *testing.T) {
+	s, pending := importConflicts(t)
+	report := runImport(t, s, pending, policySkip, map[int]string{2: policyOverwrite})
+
+	if len(report.Skipped) != 1 || report.Skipped[0].Name != "GH" || fmt.Sprint(report.Overwritten) != "[docker]" {
+		t.Errorf("report = %+v", report)
+	}
+	if got := linkState(t, s, "docker"); got != "docker https://hub.docker.com/r/%s 2" {
+		t.Errorf("docker = %s", got)
+	}
+}
+
+func TestImportPreviewInvalid(t *testing.T) {
+	s := newTestServer(t, Link{Name: "gh", URL: "https://github.com"})
+	pending := pendingImport{
+		rows: []importRow{
+			{Row: 1, Link: Link{Name: "gh", URL: "https://github.com"}},
+			{Row: 2, Link: Link{Name: "!add", URL: "https://example.com"}},
+			{Row: 3, Link: Link{Name: "js", URL: "javascript:alert(1)"}},
+			{Row: 4, Link: Link{Name: "ji", URL: "https://${JIRA}/browse/%s"}},
+			{Row: 5, Link: Link{Name: "JI", URL: "https://jira.example.com"}},
+			{Row: 6, Link: Link{Name: "form", URL: "https://example.com"}, err: errPostKeyword},
+		},
+		settings:  map[string]string{"short_length": "99", "keyword_add": "!new", "nonsense": "1"},
+		variables: map[string]string{"JIRA": "jira.example.com", "bad name": "x"},
+	}
+
+	preview, err := s.previewImport(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Links may use the variables imported with them
+	if fmt.Sprint(preview.Identical) != "[gh]" || fmt.Sprint(preview.New) != "[ji]" {
+		t.Errorf("identical %v, new %v", preview.Identical, preview.New)
+	}
+	invalid := make(map[string]bool)
+	for _, issue := range preview.Invalid {
+		invalid[issue.Name] = true
+	}
+	for _, name := range []string{"!add", "js", "JI", "form", "short_length", "nonsense", "${bad name}"} {
+		if !invalid[name] {
+			t.Errorf("%s is not in the invalid entries %v", name, preview.Invalid)
+		}
+	}
+	if len(preview.Settings) != 1 || preview.Settings["keyword_add"] != "!new" || preview.previous["keyword_add"] != "!add" {
+		t.Errorf("settings %v, previous %v", preview.Settings, preview.previous)
+	}
+}
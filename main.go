@@ -1,21 +1,38 @@
 package main
 
 import (
-	"database/sql"
 	"html/template"
 	"log"
-	"io"
 	"os"
 	"time"
 	"fmt"
 	"net/http"
+	neturl "net/url"
 	"strings"
+	"regexp"
+	"crypto/rand"
+	"math/big"
+	"sort"
+	"strconv"
 	"path/filepath"
-
-	_ "github.com/mattn/go-sqlite3"
+	"flag"
+	"net"
+	"context"
+	"os/signal"
+	"syscall"
+	"encoding/json"
 )
 
-var db *sql.DB
+// server holds what the HTTP handlers share.
+type server struct {
+	store     Store
+	dbPath    string // empty when the database isn't a SQLite file
+	backupDir string
+	staticDir string
+	s3        *s3Target     // nil when offsite backups are off
+	cipher    *backupCipher // nil when backups aren't encrypted
+	imports   *pendingImports
+}
 
 func getBaseURL(r *http.Request) string {
 	scheme := "http"
@@ -32,197 +49,534 @@ func getBaseURL(r *http.Request) string {
 	return scheme + "://" + r.Host
 }
 
-func main() {
-	// Initialize the database
-	var err error
-	db, err = sql.Open("sqlite3", "/data/items.db")
-	if err != nil {
-		log.Fatal(err)
+// Argument types a placeholder link can enforce. "regex" uses the link's own pattern.
+var argTypes = map[string]*regexp.Regexp{
+	"integer": regexp.MustCompile(`^[0-9]+$`),
+	"semver":  regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`),
+	"sha":     regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`),
+	"ticket":  regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*-[0-9]+$`),
+}
+
+// validateArgConstraint checks the argument constraint submitted with a link.
+func validateArgConstraint(url string, argType string, argRegex string) error {
+	if argType == "" {
+		return nil
+	}
+	if !strings.Contains(url, "%s") {
+		return fmt.Errorf("An argument constraint requires a placeholder in the URL.")
+	}
+	if argType == "regex" {
+		if argRegex == "" {
+			return fmt.Errorf("A regex constraint requires a pattern.")
+		}
+		if _, err := regexp.Compile(argRegex); err != nil {
+			return fmt.Errorf("Invalid regex pattern: %v", err)
+		}
+		return nil
+	}
+	if _, ok := argTypes[argType]; !ok {
+		return fmt.Errorf("Unknown argument type %q.", argType)
+	}
+	return nil
+}
+
+// validateLink checks a new link with the rules of the add form: keyword and URL set, no
+// reserved keyword, an http URL once variables are expanded, at most one placeholder, and
+// a single option or a constraint only with a placeholder.
+func validateLink(link Link, reserved map[string]string, vars map[string]string) error {
+	if link.Name == "" || link.URL == "" {
+		return fmt.Errorf("Keyword and URL cannot be empty.")
+	}
+	if strings.ContainsAny(link.Name, " \t\r\n") {
+		return fmt.Errorf("Keywords cannot contain spaces.")
+	}
+	if isReserved(link.Name, reserved) {
+		return fmt.Errorf("This keyword is reserved.")
+	}
+	if !isWebURL(expandVariables(link.URL, vars)) {
+		return fmt.Errorf("The URL must start with http:// or https://.")
+	}
+	placeholders := strings.Count(link.URL, "%s")
+	if placeholders > 1 {
+		return fmt.Errorf("You can only have one placeholder in your URL.")
+	}
+	if link.Singleword == 1 && placeholders == 0 {
+		return fmt.Errorf("A single option keyword needs a placeholder in the URL.")
+	}
+	return validateArgConstraint(link.URL, link.ArgType, link.ArgRegex)
+}
+
+// argumentMatches reports whether the option(s) passed to a link satisfy its constraint.
+// Regex patterns are anchored so they have to match the whole argument.
+func argumentMatches(argType string, argRegex string, arg string) bool {
+	if argType == "" {
+		return true
+	}
+	if argType == "regex" {
+		re, err := regexp.Compile("^(?:" + argRegex + ")$")
+		if err != nil {
+			return false
+		}
+		return re.MatchString(arg)
+	}
+	re, ok := argTypes[argType]
+	if !ok {
+		return false
+	}
+	return re.MatchString(arg)
+}
+
+// Instance-wide variables are used in URLs as ${NAME}
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+var variableName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// expandVariables replaces ${NAME} with the variable's value. Unknown variables are left untouched.
+func expandVariables(url string, vars map[string]string) string {
+	return variablePattern.ReplaceAllStringFunc(url, func(match string) string {
+		value, ok := vars[variablePattern.FindStringSubmatch(match)[1]]
+		if !ok {
+			return match
+		}
+		return value
+	})
+}
+
+// Keywords renamed on the edit page keep answering under their old name for this many days by default
+const defaultAliasDays = 30
+
+// deprecation describes a query made with the old name of a renamed keyword.
+type deprecation struct {
+	Name    string
+	Target  string
+	Expires string
+}
+
+// getActor returns the user name set by an authenticating reverse proxy (Authentik, Authelia, oauth2-proxy...).
+// GoMarks has no users of its own, so it's empty when nothing in front of it authenticates.
+func getActor(r *http.Request) string {
+	for _, header := range []string{"Remote-User", "X-Forwarded-User", "X-Authentik-Username", "X-Forwarded-Preferred-Username", "Remote-Email", "X-Forwarded-Email"} {
+		if actor := r.Header.Get(header); actor != "" {
+			return actor
+		}
+	}
+	return ""
+}
+
+// parseTrustedDomains splits the trusted_domains setting, one domain per line or comma separated.
+func parseTrustedDomains(value string) []string {
+	var domains []string
+	for _, domain := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' '
+	}) {
+		domains = append(domains, strings.ToLower(strings.TrimPrefix(domain, ".")))
 	}
-	defer db.Close()
+	return domains
+}
+
+// isWebURL reports whether a URL is an http or https one. Other schemes, javascript: in
+// particular, are never used as a destination.
+func isWebURL(url string) bool {
+	lower := strings.ToLower(strings.TrimSpace(url))
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
 
-	// Create the table if it doesn't exist
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS items (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		url TEXT NOT NULL,
-		singleword INTEGER DEFAULT 0,
-		count INTEGER DEFAULT 0
-	)`)
+// isTrusted reports whether a destination is on a trusted domain or one of its subdomains.
+// Without trusted domains configured, every http(s) destination is trusted.
+func isTrusted(destination string, trusted []string) bool {
+	if !isWebURL(destination) {
+		return false
+	}
+	if len(trusted) == 0 {
+		return true
+	}
+	u, err := neturl.Parse(destination)
 	if err != nil {
-		log.Fatal(err)
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range trusted {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Settings holding the reserved action keywords
+var reservedSettings = []string{"keyword_add", "keyword_mod", "keyword_del", "keyword_short"}
+
+// reservedKeywords returns the reserved action keywords by setting name.
+func (s *server) reservedKeywords() (map[string]string, error) {
+	reserved := make(map[string]string)
+	for _, setting := range reservedSettings {
+		value, err := s.store.GetSetting(setting)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to query %s.", setting)
+		}
+		reserved[setting] = value
+	}
+	return reserved, nil
+}
+
+// validateSetting checks the value of a setting like its form does, for the forms and for
+// imports. settings holds the values all settings will have, so reserved keywords can be
+// checked against each other.
+func (s *server) validateSetting(setting string, value string, settings map[string]string) error {
+	switch setting {
+	case "fallback_url":
+		if value == "" {
+			return fmt.Errorf("Fallback URL cannot be empty.")
+		}
+		if strings.Count(value, "{searchTerms}") != 1 {
+			return fmt.Errorf("You need exactly one {searchTerms} in your fallback URL.")
+		}
+	case "keyword_add", "keyword_mod", "keyword_del", "keyword_short":
+		if value == "" {
+			return fmt.Errorf("Reserved keywords cannot be empty.")
+		}
+		if strings.ContainsAny(value, " \t\r\n") {
+			return fmt.Errorf("Keywords cannot contain spaces.")
+		}
+		for _, other := range reservedSettings {
+			if other != setting && strings.EqualFold(settings[other], value) {
+				return fmt.Errorf("The reserved keyword %s is used twice.", value)
+			}
+		}
+		_, err := s.store.GetLink(value)
+		if err == nil {
+			return fmt.Errorf("The reserved keyword %s is already used by a link.", value)
+		}
+		if err != ErrNotFound {
+			return err
+		}
+	case "short_alphabet":
+		// At least two distinct characters and nothing that would split a query
+		distinct := make(map[rune]bool)
+		for _, c := range value {
+			distinct[c] = true
+		}
+		if len(distinct) < 2 || strings.ContainsAny(value, " \t\n\r") {
+			return fmt.Errorf("The alphabet needs at least two distinct characters and no whitespace.")
+		}
+	case "short_length":
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 1 || length > 32 {
+			return fmt.Errorf("The key length must be between 1 and 32.")
+		}
+	case "trash_days":
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 || days > 3650 {
+			return fmt.Errorf("Days before purging must be between 0 and 3650.")
+		}
+	case "backup_schedule":
+		if _, ok := backupSchedules[value]; !ok && value != "off" {
+			return fmt.Errorf("Unknown backup schedule.")
+		}
+	case "backup_keep_daily", "backup_keep_weekly":
+		kept, err := strconv.Atoi(value)
+		if err != nil || kept < 0 || kept > 1000 {
+			return fmt.Errorf("Backups to keep must be between 0 and 1000.")
+		}
+	}
+	return nil
+}
+
+// isReserved reports whether a keyword is one of the reserved action keywords.
+func isReserved(keyword string, reserved map[string]string) bool {
+	for _, value := range reserved {
+		if keyword == value {
+			return true
+		}
 	}
+	return false
+}
 
-	// Provide some examples on a new database
-	// Check if the table already has data
-	row := db.QueryRow("SELECT COUNT(name) FROM items")
-	var rowCountItems int
-	err = row.Scan(&rowCountItems)
+// generateShortKey picks a random key for a short link from the configured alphabet and length.
+// Keys already used by a shortcut, a deprecated keyword or a reserved keyword are skipped.
+func (s *server) generateShortKey() (string, error) {
+	alphabet, err := s.store.GetSetting("short_alphabet")
 	if err != nil {
-		log.Fatalf("Failed to count rows: %v", err)
-	}
-
-	if rowCountItems == 0 {
-		log.Println("Database has been created")
-		log.Println("Importing some examples")
-		// Insert some default settings
-		insertDataQuery := `
-		INSERT INTO items (name, url, singleword, count) VALUES ('amzn', 'https://www.amazon.com/s?k=%s', 0, 12);
-		INSERT INTO items (name, url, singleword, count) VALUES ('b', 'https://www.bbc.com', 0, 7);
-		INSERT INTO items (name, url, singleword, count) VALUES ('bbc', 'https://www.bbc.com/news/world/%s', 1, 3);
-		INSERT INTO items (name, url, singleword, count) VALUES ('docker', 'https://hub.docker.com/search?q=%s', 1, 33);
-		INSERT INTO items (name, url, singleword, count) VALUES ('verge', 'https://www.theverge.com/search?q=%s', 0, 69);
-		`
-		_, err = db.Exec(insertDataQuery)
+		return "", err
+	}
+	length_value, err := s.store.GetSetting("short_length")
+	if err != nil {
+		return "", err
+	}
+	length, err := strconv.Atoi(length_value)
+	if err != nil {
+		return "", err
+	}
+
+	letters := []rune(alphabet)
+	for attempt := 0; attempt < 20; attempt++ {
+		key := make([]rune, length)
+		for i := range key {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+			if err != nil {
+				return "", err
+			}
+			key[i] = letters[n.Int64()]
+		}
+
+		taken, err := s.store.KeywordTaken(string(key))
 		if err != nil {
-			log.Fatalf("Failed to insert data: %v", err)
-		} 
-	}
-	// Create a table for logging queries
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS queries (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		keyword TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)`)
+			return "", err
+		}
+		if !taken {
+			return string(key), nil
+		}
+	}
+
+	return "", fmt.Errorf("Could not find a free short key, consider increasing the key length.")
+}
+
+func main() {
+	cfg, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Create a table for extra settings
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS settings (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		setting TEXT NOT NULL UNIQUE,
-		value TEXT NOT NULL
-	)`)
+	// Initialize the database
+	srv := &server{staticDir: cfg.Static, backupDir: cfg.BackupDir, imports: newPendingImports()}
+	var store *sqlStore
+	if cfg.DSN != "" {
+		log.Println("Using PostgreSQL storage")
+		store, err = newPostgresStore(cfg.DSN)
+	} else {
+		log.Println("Using SQLite storage in", cfg.DB)
+		srv.dbPath = cfg.DB
+		store, err = newSQLiteStore(srv.dbPath)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	// Visits are written in the background, the queue is flushed when the server stops.
+	// log.Fatal skips deferred calls, fatal flushes the queue first.
+	visits := newVisitWriter(store)
+	defer visits.Close()
+	fatal := func(err error) {
+		visits.Close()
+		log.Fatal(err)
+	}
+	srv.store = newCachedStore(visits)
 
-	// Check if the table already has data
-	row2 := db.QueryRow("SELECT COUNT(setting) FROM settings")
-	var rowCount int
-	err = row2.Scan(&rowCount)
+	srv.s3, err = newS3Target(cfg)
 	if err != nil {
-		log.Fatalf("Failed to count rows: %v", err)
-	}
-
-	if rowCount == 0 {
-		log.Println("Configure default settings")
-		// Insert some default settings
-		insertDataQuery := `
-		INSERT INTO settings (setting, value) VALUES ('fallback_url', 'https://www.duckduckgo.com/?q={searchTerms}');
-		INSERT INTO settings (setting, value) VALUES ('keyword_add', '!add');
-		INSERT INTO settings (setting, value) VALUES ('keyword_mod', '!mod');
-		INSERT INTO settings (setting, value) VALUES ('keyword_del', '!del');
-		`
-		_, err = db.Exec(insertDataQuery)
-		if err != nil {
-			log.Fatalf("Failed to insert data: %v", err)
-		} 
-	} else {
-			log.Println("Database exists")
+		fatal(err)
+	}
+	if srv.s3 != nil {
+		log.Println("Offsite backups go to", srv.s3)
+	}
+
+	srv.cipher, err = newBackupCipher(cfg)
+	if err != nil {
+		fatal(err)
+	}
+	if srv.cipher != nil {
+		log.Println("Backups are encrypted")
+	}
+
+	if cfg.MigrateOnly {
+		log.Printf("Database schema is at version %d", schemaVersion)
+		return
+	}
+	if cfg.Import != "" {
+		if err := srv.importFile(cfg.Import, cfg.ImportPolicy, cfg.ImportDryRun); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	go srv.runSchedule()
+
+	// Start the server
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		fatal(err)
 	}
+	log.Printf("GoMarks 🐇 is running on http://%s", listener.Addr())
+
+	// Stop gracefully on Ctrl+C or docker stop: finish the requests in flight, then
+	// flush the pending visits before exiting
+	httpServer := &http.Server{Handler: srv.routes()}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+		log.Println("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+	if err := httpServer.Serve(listener); err != http.ErrServerClosed {
+		fatal(err)
+	}
+	// Serve returns as soon as Shutdown starts, the requests in flight may still count visits
+	<-stopped
+}
+
+// routes maps the URLs to their handlers.
+func (s *server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
 
 	// Serve static files
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
-	http.HandleFunc("/opensearch.xml", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(s.staticDir))))
+	mux.HandleFunc("/opensearch.xml", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/opensearchdescription+xml")
-		http.ServeFile(w, r, filepath.Join("./static", "opensearch.xml"))
+		http.ServeFile(w, r, filepath.Join(s.staticDir, "opensearch.xml"))
 	})
 
 	// Handlers
-	http.HandleFunc("/", handleIndex)
-	http.HandleFunc("/add", handleAdd)
-	http.HandleFunc("/go/", handleRedirect)
-	http.HandleFunc("/reset/", handleReset)
-	http.HandleFunc("/reset-all", handleResetAll)
-	http.HandleFunc("/mod/", handleMod)
-	http.HandleFunc("/mod-post/", handleModPost)
-	http.HandleFunc("/del/", handleDel)
-	http.HandleFunc("/del-post/", handleDelPost)
-	http.HandleFunc("/fallback/", handleFallback)
-	http.HandleFunc("/fallback-post/", handleFallbackPost)
-	http.HandleFunc("/reserved/", handleReserved)
-	http.HandleFunc("/reserved-post/", handleReservedPost)
-	http.HandleFunc("/clear/", handleClear)
-	http.HandleFunc("/backup", handleBackup)
-	http.HandleFunc("/help/", handleHelp)
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/add", s.handleAdd)
+	mux.HandleFunc("/go/", s.handleRedirect)
+	mux.HandleFunc("/reset/", s.handleReset)
+	mux.HandleFunc("/reset-all", s.handleResetAll)
+	mux.HandleFunc("/mod/", s.handleMod)
+	mux.HandleFunc("/mod-post/", s.handleModPost)
+	mux.HandleFunc("/revert/", s.handleRevert)
+	mux.HandleFunc("/del/", s.handleDel)
+	mux.HandleFunc("/del-post/", s.handleDelPost)
+	mux.HandleFunc("/fallback/", s.handleFallback)
+	mux.HandleFunc("/fallback-post/", s.handleFallbackPost)
+	mux.HandleFunc("/reserved/", s.handleReserved)
+	mux.HandleFunc("/reserved-post/", s.handleReservedPost)
+	mux.HandleFunc("/variables/", s.handleVariables)
+	mux.HandleFunc("/variables-post/", s.handleVariablesPost)
+	mux.HandleFunc("/variables-del/", s.handleVariablesDel)
+	mux.HandleFunc("/alias-del/", s.handleAliasDel)
+	mux.HandleFunc("/trash/", s.handleTrash)
+	mux.HandleFunc("/trash-post/", s.handleTrashPost)
+	mux.HandleFunc("/trash-restore/", s.handleTrashRestore)
+	mux.HandleFunc("/trash-del/", s.handleTrashDel)
+	mux.HandleFunc("/trusted/", s.handleTrusted)
+	mux.HandleFunc("/trusted-post/", s.handleTrustedPost)
+	mux.HandleFunc("/short", s.handleShort)
+	mux.HandleFunc("/short/", s.handleShortResult)
+	mux.HandleFunc("/short-prune", s.handleShortPrune)
+	mux.HandleFunc("/shortener/", s.handleShortener)
+	mux.HandleFunc("/shortener-post/", s.handleShortenerPost)
+	mux.HandleFunc("/clear/", s.handleClear)
+	mux.HandleFunc("/backup", s.handleBackup)
+	mux.HandleFunc("/backup-download", s.handleBackupDownload)
+	mux.HandleFunc("/backups/", s.handleBackups)
+	mux.HandleFunc("/backups-post/", s.handleBackupsPost)
+	mux.HandleFunc("/backups-del/", s.handleBackupsDel)
+	mux.HandleFunc("/restore/", s.handleRestore)
+	mux.HandleFunc("/restore-post/", s.handleRestorePost)
+	mux.HandleFunc("/restore-upload", s.handleRestoreUpload)
+	mux.HandleFunc("/export", s.handleExport)
+	mux.HandleFunc("/import/", s.handleImport)
+	mux.HandleFunc("/import-post", s.handleImportPost)
+	mux.HandleFunc("/import-apply", s.handleImportApply)
+	mux.HandleFunc("/audit/", s.handleAudit)
+	mux.HandleFunc("/audit.json", s.handleAuditJSON)
+	mux.HandleFunc("/help/", s.handleHelp)
+
+	return mux
+}
 
-	// Start the server
-	log.Println("GoMarks 🐇 is running on http://localhost:8080")
-	http.ListenAndServe(":8080", nil)
+// Rows of the index page
+type indexItem struct {
+	Link
+	Href string
+}
+
+type indexQuery struct {
+	Keyword   string
+	CreatedAt string
+}
+
+type indexAlias struct {
+	Name    string
+	Target  string
+	Expires string
+	Count   int
+}
+
+type indexShort struct {
+	Name    string
+	URL     string
+	Count   int
+	Created string
 }
 
-func handleIndex(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	// Fetch items from the database
-	rows, err := db.Query("SELECT id, name, url, singleword, count FROM items ORDER BY name ASC")
+	links, err := s.store.ListLinks()
 	if err != nil {
 		http.Error(w, "Failed to fetch items.", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	// Fetch the last 10 queries from the queries table
-	queriesRows, err := db.Query("SELECT keyword, created_at FROM queries ORDER BY created_at DESC LIMIT 30")
+	// Fetch the last 30 queries from the queries table
+	recent, err := s.store.RecentQueries(30)
 	if err != nil {
 		http.Error(w, "Failed to fetch queries.", http.StatusInternalServerError)
 		return
 	}
-	defer queriesRows.Close()
 
-	var items []struct {
-		ID    int
-		Name  string
-		URL   string
-		Singleword int
-		Count int
+	// Links point to the URL with variables expanded
+	vars, err := s.store.Variables()
+	if err != nil {
+		http.Error(w, "Failed to fetch variables.", http.StatusInternalServerError)
+		return
 	}
-	for rows.Next() {
-		var item struct {
-			ID    int
-			Name  string
-			URL   string
-			Singleword int
-			Count int
+
+	// Short links generated by the URL shortener are listed apart from hand-curated shortcuts, newest first
+	var items []indexItem
+	var generated []Link
+	for _, link := range links {
+		if link.Generated == 1 {
+			generated = append(generated, link)
+			continue
 		}
-		if err := rows.Scan(&item.ID, &item.Name, &item.URL, &item.Singleword, &item.Count); err != nil {
-			http.Error(w, "Failed to parse items.", http.StatusInternalServerError)
-			return
+		items = append(items, indexItem{Link: link, Href: expandVariables(link.URL, vars)})
+	}
+	sort.SliceStable(generated, func(i, j int) bool {
+		return generated[i].CreatedAt.After(generated[j].CreatedAt)
+	})
+
+	var shorts []indexShort
+	for _, link := range generated {
+		short := indexShort{Name: link.Name, URL: link.URL, Count: link.Count}
+		if !link.CreatedAt.IsZero() {
+			short.Created = link.CreatedAt.Format("2006-01-02")
 		}
-		items = append(items, item)
+		shorts = append(shorts, short)
 	}
 
-	var queries []struct {
-		Keyword   string
-		CreatedAt string
+	var queries []indexQuery
+	for _, query := range recent {
+		queries = append(queries, indexQuery{Keyword: query.Keyword, CreatedAt: query.CreatedAt.Format(time.RFC3339)})
 	}
-	for queriesRows.Next() {
-		var query struct {
-			Keyword   string
-			CreatedAt string
-		}
-		if err := queriesRows.Scan(&query.Keyword, &query.CreatedAt); err != nil {
-			http.Error(w, "Failed to parse queries.", http.StatusInternalServerError)
-			return
-		}
-		queries = append(queries, query)
+
+	// Deprecated keywords past their transition period are left out, the schedule deletes them
+	deprecated, err := s.store.ListAliases(time.Now())
+	if err != nil {
+		http.Error(w, "Failed to fetch deprecated keywords.", http.StatusInternalServerError)
+		return
+	}
+
+	var aliases []indexAlias
+	for _, alias := range deprecated {
+		aliases = append(aliases, indexAlias{Name: alias.Name, Target: alias.Target, Expires: alias.ExpiresAt.Format("2006-01-02"), Count: alias.Count})
 	}
 
 	// Get current fallback engine
-	var fallback_url string
-	err = db.QueryRow("SELECT value FROM settings WHERE setting='fallback_url'").Scan(&fallback_url)
+	fallback_url, err := s.store.GetSetting("fallback_url")
 	if err != nil {
 		http.Error(w, "Fallback URL not found.", http.StatusNotFound)
 		return
 	}
 
 	// Count number of items
-	var countlinks string
-	err = db.QueryRow("SELECT COUNT(name) FROM items").Scan(&countlinks)
-	if err != nil {
-		http.Error(w, "Failed to count items.", http.StatusInternalServerError)
-		return
-	}
+	countlinks := strconv.Itoa(len(items))
 
 	// Render the index page
 	tmpl := `
@@ -298,6 +652,14 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
         const deletedShortcut = params.get('deleted');
         const modifiedFallback = params.get('fallback');
         const modifiedReserved = params.get('reserved');
+        const modifiedVariables = params.get('variables');
+        const modifiedTrusted = params.get('trusted');
+        const modifiedShortener = params.get('shortener');
+        const prunedShorts = params.get('pruned');
+        const modifiedBackups = params.get('backups');
+        const restoredBackup = params.get('restored');
+        const modifiedTrash = params.get('trash');
+        const undeletedShortcut = params.get('undeleted');
         if (addedShortcut) {
             showPopup('New shortcut ' + addedShortcut + ' has been added!', 5000);
         }
@@ -305,7 +667,7 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             showPopup('Shortcut ' + modifiedShortcut + ' has been updated!', 5000);
         }
         if (deletedShortcut) {
-            showPopup('Shortcut ' + deletedShortcut + ' has been deleted!', 5000);
+            showPopup('Shortcut ' + deletedShortcut + ' has been moved to the trash!', 5000);
         }
         if (modifiedFallback) {
             showPopup('Fallback search engine has been updated!', 5000);
@@ -313,6 +675,30 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
         if (modifiedReserved) {
             showPopup('Reserved keywords have been updated!', 5000);
         }
+        if (modifiedVariables) {
+            showPopup('Variables have been updated!', 5000);
+        }
+        if (modifiedTrusted) {
+            showPopup('Trusted domains have been updated!', 5000);
+        }
+        if (modifiedShortener) {
+            showPopup('URL shortener has been updated!', 5000);
+        }
+        if (prunedShorts) {
+            showPopup(prunedShorts + ' short links have been deleted!', 5000);
+        }
+        if (modifiedBackups) {
+            showPopup('Backup settings have been updated!', 5000);
+        }
+        if (restoredBackup) {
+            showPopup('Database has been restored from ' + restoredBackup + '!', 5000);
+        }
+        if (modifiedTrash) {
+            showPopup('Trash settings have been updated!', 5000);
+        }
+        if (undeletedShortcut) {
+            showPopup('Shortcut ' + undeletedShortcut + ' has been restored!', 5000);
+        }
     </script>
 
 		<h2><a href=".">GoMarks <img src="/static/favicon.png" width="32" height="32"></a></h2>
@@ -374,9 +760,29 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
       <label for="singleword">1️⃣ single option keyword</label>
       <a href="/help/#placeholder">?</a>
     </div>
+
+    <details style="margin: 10px 0;">
+      <summary>🎯 Option constraint <a href="/help/#constraints">?</a></summary>
+      <select name="arg_type" id="arg_type" disabled>
+        <option value="">none</option>
+        <option value="integer">integer</option>
+        <option value="semver">semver</option>
+        <option value="sha">hex SHA</option>
+        <option value="ticket">ticket ID (ABC-123)</option>
+        <option value="regex">custom regex</option>
+      </select>
+      <input type="text" name="arg_regex" id="arg_regex" placeholder="Regex (custom regex only)" autocomplete="off" disabled>
+      <input type="text" name="arg_alternate" id="arg_alternate" placeholder="Keyword to use when the option doesn't match (default: fallback)" autocomplete="off" disabled>
+    </details>
     
     <button type="submit">Add new shortcut</button>
   </form>
+
+  <!-- Shorten URL Form -->
+  <form action="/short" method="post">
+    <input type="url" name="url" placeholder="Long URL to shorten" required autocomplete="off">
+    <button type="submit">Shorten</button>
+  </form>
 </div>
 		<script>
 		// enable checkbox if placeholder in URL
@@ -388,6 +794,9 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 		  // Enable the checkbox if the URL contains "%s" (case-insensitive)
 		  const value = textField.value	;
 		  singleword.disabled = !value.includes('%s');
+		  arg_type.disabled = !value.includes('%s');
+		  arg_regex.disabled = !value.includes('%s');
+		  arg_alternate.disabled = !value.includes('%s');
 		});
 		</script>
 
@@ -420,8 +829,9 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 						</a>
 					</code>
 					{{if eq .Singleword 1}} 1️⃣{{end}}
+					{{if .ArgType}} <span title="Option must be {{.ArgType}}">🎯</span>{{end}}
 				</td>
-				<td><a href="{{.URL}}" target="_blank">{{.URL}}</a></td>
+				<td><a href="{{.Href}}" target="_blank">{{.URL}}</a></td>
 				<td style="text-align: center;">{{.Count}}</td>
 				<td style="text-align: center;">
 					<a title="Reset visit count" href="/reset/{{.Name}}">♻️</a> 
@@ -455,6 +865,65 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 	</script>
 
+		{{if .Shorts}}
+		<h2>Short links</h2>
+
+		<table class="links">
+			<tr>
+				<th style="text-align: left; width: 150px">Key</th>
+				<th style="width: 200px;">Destination URL</th>
+				<th style="text-align: center; width: 100px">Visits</th>
+				<th style="text-align: center; width: 150px">Created</th>
+				<th style="text-align: center; width: 150px">Management</th>
+			</tr>
+			{{range .Shorts}}
+			<tr>
+				<td><code><a href="/short/{{.Name}}">{{.Name}}</a></code></td>
+				<td><a href="{{.URL}}" target="_blank">{{.URL}}</a></td>
+				<td style="text-align: center;">{{.Count}}</td>
+				<td style="text-align: center;">{{.Created}}</td>
+				<td style="text-align: center;">
+					<a title="Edit short link" href="/mod/{{.Name}}">✍🏻</a>
+					<a title="Delete short link" href="/del/{{.Name}}">❌</a>
+				</td>
+			</tr>
+			{{end}}
+		</table>
+
+		<form action="/short-prune" method="post">
+			Delete short links older than <input type="number" name="days" value="30" min="0" style="width: 60px;"> days
+			<input type="checkbox" id="unused" name="unused" checked> <label for="unused">never visited only</label>
+			<button type="submit">Prune</button>
+		</form>
+		{{end}}
+
+		{{if .Aliases}}
+		<h2>Deprecated keywords</h2>
+
+		<table class="history">
+			<tr>
+				<th>Old keyword</th>
+				<th>Moved to</th>
+				<th>Until</th>
+				<th style="text-align: center;">Still used</th>
+				<th style="text-align: center;">Management</th>
+			</tr>
+			{{range .Aliases}}
+			<tr>
+				<td><code>{{.Name}}</code></td>
+				<td><code><a href="/go/?q={{.Target}}" target="_blank">{{.Target}}</a></code></td>
+				<td>{{.Expires}}</td>
+				<td style="text-align: center;">{{.Count}}</td>
+				<td style="text-align: center;">
+					<form action="/alias-del/{{.Name}}" method="post" style="display: inline;">
+						<button type="submit" title="Stop answering to the old keyword now">❌</button>
+					</form>
+				</td>
+			</tr>
+			{{end}}
+		</table>
+		{{end}}
+
 		<h2>Last 30 queries</h2>
 
 		<table class="history">
@@ -503,6 +972,16 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 
 		<p><a href="/fallback">Configure fallback search engine</a></p>
 
+		<p><a href="/variables">Configure variables</a></p>
+
+		<p><a href="/trusted">Configure trusted domains</a></p>
+
+		<p><a href="/shortener">Configure URL shortener</a></p>
+		<p><a href="/backups">Manage backups</a></p>
+		<p><a href="/trash">Trash</a></p>
+		<p><a href="/import">Export and import</a></p>
+		<p><a href="/audit">Audit log</a></p>
+
 		<button onclick="backup()">Backup database</button>
 
 		<script>
@@ -520,28 +999,23 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 
 	tmplParsed := template.Must(template.New("index").Parse(tmpl))
 	tmplParsed.Execute(w, struct {
-		Items   []struct {
-			ID    int
-			Name  string
-			URL   string
-			Singleword int
-			Count int
-		}
-		Queries []struct {
-			Keyword   string
-			CreatedAt string
-		}
+		Items   []indexItem
+		Queries []indexQuery
+		Aliases []indexAlias
+		Shorts []indexShort
 		Fallback string
 		Countlinks string
 	}{
 		Items:   items,
 		Queries: queries,
+		Aliases: aliases,
+		Shorts: shorts,
 		Fallback: fallback_url,
 		Countlinks: countlinks,
 	})
 }
 
-func handleAdd(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleAdd(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
 		return
@@ -550,70 +1024,67 @@ func handleAdd(w http.ResponseWriter, r *http.Request) {
 	name := r.FormValue("name")
 	url := r.FormValue("url")
 	singlewordvalue := r.FormValue("singleword")
-	if name == "" || url == "" {
-		http.Error(w, "Keyword and URL cannot be empty.", http.StatusBadRequest)
-		return
+
+	var singleword int
+	if singlewordvalue == "on" {
+		singleword = 1
 	}
 
-	// Block shortcut creation using reserved keywords
-	var reserved_add string
-	err := db.QueryRow("SELECT value FROM settings WHERE setting = 'keyword_add'").Scan(&reserved_add)
-	if err != nil {
-		http.Error(w, "Failed to query keyword_add.", http.StatusInternalServerError)
-		return
+	// Optional constraint on the option passed to the placeholder
+	arg_type := r.FormValue("arg_type")
+	arg_regex := r.FormValue("arg_regex")
+	arg_alternate := r.FormValue("arg_alternate")
+	if arg_type != "regex" {
+		arg_regex = ""
+	}
+	if arg_type == "" {
+		arg_alternate = ""
+	}
+
+	link := Link{
+		Name:         name,
+		URL:          url,
+		Singleword:   singleword,
+		ArgType:      arg_type,
+		ArgRegex:     arg_regex,
+		ArgAlternate: arg_alternate,
+		Owner:        getActor(r),
+		UpdatedAt:    time.Now(),
 	}
-	var reserved_mod string
-	err = db.QueryRow("SELECT value FROM settings WHERE setting = 'keyword_mod'").Scan(&reserved_mod)
+
+	// Block reserved keywords, more than one placeholder and the like
+	reserved, err := s.reservedKeywords()
 	if err != nil {
-		http.Error(w, "Failed to query keyword_mod.", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	var reserved_del string
-	err = db.QueryRow("SELECT value FROM settings WHERE setting = 'keyword_del'").Scan(&reserved_del)
+	vars, err := s.store.Variables()
 	if err != nil {
-		http.Error(w, "Failed to query keyword_del.", http.StatusInternalServerError)
+		http.Error(w, "Failed to fetch variables.", http.StatusInternalServerError)
 		return
 	}
-
-	if name == reserved_add || name == reserved_mod || name == reserved_del {
-		http.Error(w, "This keyword is reserved.", http.StatusInternalServerError)
+	err = validateLink(link, reserved, vars)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var singleword int
-	// singleword
-	if singlewordvalue == "" {
-		singleword = 0
-	} 
-	
-	if singlewordvalue == "on" {
-		singleword = 1
-	}
-
-	// Max one placeholder in URL
-	placeholder_count := strings.Count(url, "%s")
-
-	if placeholder_count > 1 {
-		http.Error(w, "You can only have one placeholder in your URL.", http.StatusMethodNotAllowed)
-		return
-	} 
-
-	_, err = db.Exec("INSERT INTO items (name, url, singleword) VALUES (?, ?, ?)", name, url, singleword)
+	err = s.store.AddLink(link)
 	if err != nil {
 		http.Error(w, "Failed to add shortlink. Ensure the keyword is unique.", http.StatusInternalServerError)
 		return
 	}
+	s.audit(r, "link.create", name, "", linkJSON(link))
 
 	http.Redirect(w, r, "/?added=" + name, http.StatusSeeOther)
 }
 
-func handleRedirect(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleRedirect(w http.ResponseWriter, r *http.Request) {
 	queryValues := r.URL.Query()
 	query := queryValues.Get("q")
 
 	// Making vars available in the whole function
 	var url string
-	var fallback_url string
 	var destination_url string
 	var singleword int
 	var placeholder_present bool
@@ -621,6 +1092,12 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 	var keyword string
 	var second_word string
 	var second_word_and_all string
+	var arg_type string
+	var arg_regex string
+	var arg_alternate string
+	var deprecated *deprecation
+	var link Link
+	var searching bool
 
 	// Fail if no query provided
 	if query == "" {
@@ -629,21 +1106,32 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Getting the fallback URL as it will come handy
-	err := db.QueryRow("SELECT value FROM settings WHERE setting='fallback_url'").Scan(&fallback_url)
+	fallback_url, err := s.store.GetSetting("fallback_url")
 	if err != nil {
 		http.Error(w, "Fallback URL not found.", http.StatusInternalServerError)
 		return
 	}
 
+	// Variables used in destination URLs (ex: ${JIRA})
+	vars, err := s.store.Variables()
+	if err != nil {
+		http.Error(w, "Failed to fetch variables.", http.StatusInternalServerError)
+		return
+	}
+	fallback_url = expandVariables(fallback_url, vars)
+
+	// Destinations outside of these domains get a warning page first
+	trusted_domains, err := s.store.GetSetting("trusted_domains")
+	if err != nil {
+		http.Error(w, "Trusted domains not found.", http.StatusInternalServerError)
+		return
+	}
+
 	// Query has been provided, let's get to work
 	if query != "" {
 
-		// Add query to history
-		_, err := db.Exec("INSERT INTO queries (keyword) VALUES (?)", query)
-		if err != nil {
-			http.Error(w, "Failed to log query.", http.StatusInternalServerError)
-			return
-		}	
+		// Add query to history, written in the background so it never holds the redirect
+		s.store.LogQuery(query)
 
 		// Manipulate the query
 		words := strings.Fields(query)
@@ -663,28 +1151,19 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 		}
 		
 		// Check if keyword matches any reserved keyword
-		var reserved_add string
-		err = db.QueryRow("SELECT value FROM settings WHERE setting = 'keyword_add'").Scan(&reserved_add)
-		if err != nil {
-			http.Error(w, "Failed to query keyword_add.", http.StatusInternalServerError)
-			return
-		}
-		var reserved_mod string
-		err = db.QueryRow("SELECT value FROM settings WHERE setting = 'keyword_mod'").Scan(&reserved_mod)
-		if err != nil {
-			http.Error(w, "Failed to query keyword_mod.", http.StatusInternalServerError)
-			return
-		}
-		var reserved_del string
-		err = db.QueryRow("SELECT value FROM settings WHERE setting = 'keyword_del'").Scan(&reserved_del)
+		reserved, err := s.reservedKeywords()
 		if err != nil {
-			http.Error(w, "Failed to query keyword_del.", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		reserved_add := reserved["keyword_add"]
+		reserved_mod := reserved["keyword_mod"]
+		reserved_del := reserved["keyword_del"]
+		reserved_short := reserved["keyword_short"]
 
 		// prevents adding shortcuts using reserved keywords
 		if len(words) > 1 {
-			if words[1] == reserved_add || words[1] == reserved_mod || words[1] == reserved_del {
+			if isReserved(words[1], reserved) {
 				http.Error(w, "This keyword is reserved.", http.StatusInternalServerError)
 				return
 			}
@@ -703,7 +1182,7 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 				name := words[1]
 				url := words[2]
 
-				if strings.Contains(url, "http") {
+				if isWebURL(url) {
 
 				// if 1 is passed
 				if len(words) == 4 {
@@ -726,11 +1205,13 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-				_, err := db.Exec("INSERT INTO items (name, url, singleword) VALUES (?, ?, ?)", name, url, singleword)
+				link := Link{Name: name, URL: url, Singleword: singleword, Owner: getActor(r), UpdatedAt: time.Now()}
+				err := s.store.AddLink(link)
 				if err != nil {
 					http.Error(w, "Failed to add shortlink. Ensure the keyword is unique.", http.StatusInternalServerError)
 					return
 				} else {
+					s.audit(r, "link.create", name, "", linkJSON(link))
 					http.Redirect(w, r, "/?added=" + name, http.StatusSeeOther)
 					return
 				}
@@ -762,29 +1243,75 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// short action
+		if keyword == reserved_short {
+			// shortening requires exactly two words (reserved_short + the long URL)
+			if words_counting != 2 || !isWebURL(words[1]) {
+				http.Error(w, "Shortening a link requires exactly one URL.\n\nExample usage: " + reserved_short + " https://example.com/a/very/long/url", http.StatusBadRequest)
+				return
+			}
+
+			key, err := s.addShortLink(words[1], getActor(r))
+			if err != nil {
+				http.Error(w, "Failed to shorten the link: " + err.Error(), http.StatusInternalServerError)
+				return
+			}
+			s.audit(r, "short.create", key, "", words[1])
+
+			http.Redirect(w, r, "/short/" + key, http.StatusSeeOther)
+			return
+		}
+
 		// Assess the first word in the query and check if a keyword matches
-		// We force lowercase to make things case insensitive
+		// The store matches keywords case insensitively
 		var keyword_found int
-		err = db.QueryRow("SELECT COUNT(name) FROM items where LOWER(name) = LOWER(?)", keyword).Scan(&keyword_found)
-		if err != nil {
-			http.Error(w, "Failed to count.", http.StatusInternalServerError)
+		link, err = s.store.GetLink(keyword)
+		if err == nil {
+			keyword_found = 1
+		} else if err != ErrNotFound {
+			http.Error(w, "Failed to retrieve destination URL.", http.StatusInternalServerError)
 			return
 		}
 
-		// Scenario
-		// Keyword not found
-		// Outcome: pass the full query to the fallback URL
+		// Keyword not found but it's the old name of a renamed keyword
+		// Outcome: carry on with the new name and tell the user about it
 		if keyword_found == 0 {
-			url = strings.ReplaceAll(fallback_url, "{searchTerms}", query)
-		}
+			alias, err := s.store.GetAlias(keyword, time.Now())
+			if err != nil && err != ErrNotFound {
+				http.Error(w, "Failed to look up deprecated keywords.", http.StatusInternalServerError)
+				return
+			}
+			if err == nil {
+				log.Printf("Deprecated keyword %q used, it moved to %q", keyword, alias.Target)
+				s.store.IncrementAliasCount(keyword)
+				deprecated = &deprecation{Name: keyword, Target: alias.Target, Expires: alias.ExpiresAt.Format("2006-01-02")}
+				keyword = alias.Target
+
+				link, err = s.store.GetLink(keyword)
+				if err == nil {
+					keyword_found = 1
+				} else if err != ErrNotFound {
+					http.Error(w, "Failed to retrieve destination URL.", http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		// Scenario
+		// Keyword not found
+		// Outcome: pass the full query to the fallback URL
+		if keyword_found == 0 {
+			url = strings.ReplaceAll(fallback_url, "{searchTerms}", query)
+			searching = true
+		}
 
 		// if keyword is not reserved and found, fetch the destination URL
 		if keyword_found == 1 {
-			err = db.QueryRow("SELECT url, singleword FROM items WHERE LOWER(name) = LOWER(?)", keyword).Scan(&destination_url, &singleword)
-			if err != nil {
-				http.Error(w, "Failed to retrieve destination URL.", http.StatusInternalServerError)
-				return
-			}
+			destination_url = expandVariables(link.URL, vars)
+			singleword = link.Singleword
+			arg_type = link.ArgType
+			arg_regex = link.ArgRegex
+			arg_alternate = link.ArgAlternate
 		}
 
 		// Check if URL contains a placeholder. In this case, we expect at least two words
@@ -822,43 +1349,224 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 			// outcome: success, taking to destination (ex: docker alpine)
 			if words_counting == 2 {
 				url = strings.ReplaceAll(destination_url, "%s", second_word)
+
+				// the option doesn't satisfy the link's constraint
+				// outcome: alternate link or fallback (ex: pr main instead of pr 1234)
+				if !argumentMatches(arg_type, arg_regex, second_word) {
+					url, searching, err = s.alternateURL(arg_alternate, second_word, fallback_url, query, vars)
+					if err != nil {
+						http.Error(w, "Failed to retrieve alternate URL.", http.StatusInternalServerError)
+						return
+					}
+				}
 			}
 			// more than one word specified while single word is expected
 			// outcome: not taking to destination URL but fallback (ex: docker versus kubernetes)
 			if words_counting > 2 {
 				url = strings.ReplaceAll(fallback_url, "{searchTerms}", query)
+				searching = true
 			}
 		}
 
 		// two or more words, URL expects an option but it can be multiple words (ex: amazon search)
 		if keyword_found == 1 && words_counting >= 2 && placeholder_present && singleword == 0 {
 			url = strings.ReplaceAll(destination_url, "%s", second_word_and_all)
+
+			// the option(s) don't satisfy the link's constraint
+			// outcome: alternate link or fallback
+			if !argumentMatches(arg_type, arg_regex, second_word_and_all) {
+				url, searching, err = s.alternateURL(arg_alternate, second_word_and_all, fallback_url, query, vars)
+				if err != nil {
+					http.Error(w, "Failed to retrieve alternate URL.", http.StatusInternalServerError)
+					return
+				}
+			}
 		}
 
 		// update the visit count
-		db.Exec("UPDATE items SET count = count + 1 WHERE name = ?", keyword)
+		s.store.IncrementCount(keyword)
+
+		// Untrusted destination, tell the user where they're going and who set it up
+		if !isTrusted(url, parseTrustedDomains(trusted_domains)) {
+			warning := untrustedWarning{URL: url, Searching: searching, Keyword: keyword, Owner: link.Owner, Deprecated: deprecated}
+			if !link.UpdatedAt.IsZero() {
+				warning.Edited = link.UpdatedAt.Format("2006-01-02 15:04")
+			}
+			renderUntrustedWarning(w, warning)
+			return
+		}
+
+		// Old keyword, let the user know where it moved before redirecting
+		if deprecated != nil {
+			renderMovedNotice(w, url, *deprecated)
+			return
+		}
 		
 		// Final call
 		http.Redirect(w, r, url, http.StatusFound)
 		}
 }
-func handleReset(w http.ResponseWriter, r *http.Request) {
+
+// renderMovedNotice redirects after a short notice telling the user a keyword has been renamed.
+func renderMovedNotice(w http.ResponseWriter, url string, dep deprecation) {
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<meta http-equiv="refresh" content="3;url={{.URL}}">
+		<title>GoMarks - Keyword moved</title>
+		<link rel="stylesheet" href="/static/style.css">
+	</head>
+	<body>
+		<h2><a href="/">This link moved to <code>{{.Target}}</code></a></h2>
+		The keyword <code>{{.Name}}</code> has been renamed to <code>{{.Target}}</code> and will stop working on {{.Expires}}.</p>
+		Redirecting you to <a href="{{.URL}}">{{.URL}}</a>…</p>
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("moved").Parse(tmpl))
+	tmplParsed.Execute(w, struct {
+		deprecation
+		URL string
+	}{
+		deprecation: dep,
+		URL:         url,
+	})
+}
+
+// untrustedWarning describes a redirect to a domain outside of the trusted domains.
+type untrustedWarning struct {
+	URL        string
+	Searching  bool
+	Keyword    string
+	Owner      string
+	Edited     string
+	Deprecated *deprecation
+}
+
+// renderUntrustedWarning asks the user to confirm a redirect to an untrusted domain.
+func renderUntrustedWarning(w http.ResponseWriter, warning untrustedWarning) {
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks - Leaving trusted domains</title>
+		<link rel="stylesheet" href="/static/style.css">
+		<script>
+		function goToIndex() {
+			window.location.href = "/";
+		}
+		</script>
+	</head>
+	<body>
+		<h2><a href="/">⚠️ You are leaving trusted domains</a></h2>
+		You are about to visit <code>{{.Host}}</code></p>
+		<code>{{.URL}}</code></p>
+		{{if .Searching}}
+		This is a search with the fallback search engine.</p>
+		{{else}}
+		This destination comes from the shortcut <code>{{.Keyword}}</code>, owned by {{if .Owner}}<code>{{.Owner}}</code>{{else}}an unknown user{{end}}{{if .Edited}} and last edited on {{.Edited}} UTC{{end}}.</p>
+		{{end}}
+		{{with .Deprecated}}
+		The keyword <code>{{.Name}}</code> has been renamed to <code>{{.Target}}</code> and will stop working on {{.Expires}}.</p>
+		{{end}}
+		<a href="{{.URL}}">Continue</a></p>
+		<button type="button" onclick="goToIndex()">Cancel</button>
+	</body>
+	</html>
+	`
+
+	host := warning.URL
+	if u, err := neturl.Parse(warning.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	tmplParsed := template.Must(template.New("untrusted").Parse(tmpl))
+	tmplParsed.Execute(w, struct {
+		untrustedWarning
+		Host string
+	}{
+		untrustedWarning: warning,
+		Host:             host,
+	})
+}
+
+// alternateURL builds the destination for an option rejected by a link's constraint.
+// It uses the alternate keyword when one is set and exists, the fallback search engine otherwise,
+// and reports which one it picked.
+func (s *server) alternateURL(alternate string, option string, fallback_url string, query string, vars map[string]string) (string, bool, error) {
+	if alternate != "" {
+		link, err := s.store.GetLink(alternate)
+		if err == nil {
+			return strings.ReplaceAll(expandVariables(link.URL, vars), "%s", option), false, nil
+		}
+		if err != ErrNotFound {
+			return "", false, err
+		}
+	}
+
+	return strings.ReplaceAll(fallback_url, "{searchTerms}", query), true, nil
+}
+
+func (s *server) handleReset(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Path[len("/reset/"):]
 	if name == "" {
 		http.Error(w, "Keyword is required to reset the visit counter.", http.StatusBadRequest)
 		return
 	}
 
-	db.Exec("UPDATE items SET count = 0 WHERE name = ?", name)
+	link, err := s.store.GetLink(name)
+	if err != nil {
+		http.Error(w, "Keyword not found.", http.StatusNotFound)
+		return
+	}
+	if link.Count > 0 {
+		err = s.store.ResetCount(link.Name)
+		if err == ErrNotFound {
+			http.Error(w, "Keyword not found.", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to reset the visit counter.", http.StatusInternalServerError)
+			return
+		}
+		s.audit(r, "count.reset", link.Name, strconv.Itoa(link.Count), "0")
+	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func handleResetAll(w http.ResponseWriter, r *http.Request) {
-	db.Exec("UPDATE items SET count = 0")
+func (s *server) handleResetAll(w http.ResponseWriter, r *http.Request) {
+	// The counters as they were, for the audit log
+	links, err := s.store.ListLinks()
+	if err != nil {
+		http.Error(w, "Failed to fetch the links.", http.StatusInternalServerError)
+		return
+	}
+	counts := make(map[string]int)
+	for _, link := range links {
+		if link.Count > 0 {
+			counts[link.Name] = link.Count
+		}
+	}
+
+	reset, err := s.store.ResetAllCounts()
+	if err != nil {
+		http.Error(w, "Failed to reset the visit counters.", http.StatusInternalServerError)
+		return
+	}
+	if reset > 0 {
+		before, _ := json.Marshal(counts)
+		s.audit(r, "count.reset_all", "", string(before), fmt.Sprintf("%d counters set to 0", reset))
+	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func handleMod(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleMod(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Path[len("/mod/"):]
 	if name == "" {
 		http.Error(w, "Keyword is required to modify a link.", http.StatusBadRequest)
@@ -871,14 +1579,33 @@ func handleMod(w http.ResponseWriter, r *http.Request) {
 		URL  string
 		Singleword int
 		Checkbox string
+		ArgType string
+		ArgRegex string
+		ArgAlternate string
+		AliasDays int
+		History []historyEntry
 	}
+	item.AliasDays = defaultAliasDays
 
 
-	err := db.QueryRow("SELECT id, name, url, singleword FROM items WHERE LOWER(name) = LOWER(?)", name).Scan(&item.ID, &item.Name, &item.URL, &item.Singleword)
+	link, err := s.store.GetLink(name)
 	if err != nil {
 		http.Error(w, "Keyword not found.", http.StatusNotFound)
 		return
 	}
+	item.ID = link.ID
+	item.Name = link.Name
+	item.URL = link.URL
+	item.Singleword = link.Singleword
+	item.ArgType = link.ArgType
+	item.ArgRegex = link.ArgRegex
+	item.ArgAlternate = link.ArgAlternate
+
+	item.History, err = s.linkHistory(link)
+	if err != nil {
+		http.Error(w, "Failed to fetch the history of the link.", http.StatusInternalServerError)
+		return
+	}
 
 	// defining the state of the checkbox
 	if strings.Contains(item.URL, "%s") {
@@ -900,15 +1627,38 @@ func handleMod(w http.ResponseWriter, r *http.Request) {
 		function goToIndex() {
 			window.location.href = "/";
 		}
+		function showTab(tab) {
+			document.getElementById('edit').style.display = tab === 'edit' ? 'block' : 'none';
+			document.getElementById('history').style.display = tab === 'history' ? 'block' : 'none';
+		}
 		</script>
 	</head>
 	<body>
 		<h2><a href="/">Edit Link</a></h2>
+		<p><a href="#" onclick="showTab('edit'); return false;">Edit</a> | <a href="#" onclick="showTab('history'); return false;">History ({{len .History}})</a></p>
+		<div id="edit">
 		<form action="/mod-post/{{.Name}}" method="post">
 			<input type="text" name="name" value="{{.Name}}" placeholder="Keyword"required>
 			<input type="url" name="url" id="url" value="{{.URL}}" placeholder="Destination URL" required autocomplete="off">
 			<label for="singleword">1️⃣ single option keyword</label>
 			<input type="checkbox" id="singleword" name="singleword" {{if eq .Singleword 1}}checked{{end}} {{.Checkbox}}> (<a href="/help/#placeholder">?</a>)
+			<p>
+			<label for="arg_type">🎯 Option constraint</label>
+			<select name="arg_type" id="arg_type" {{.Checkbox}}>
+				<option value="" {{if eq .ArgType ""}}selected{{end}}>none</option>
+				<option value="integer" {{if eq .ArgType "integer"}}selected{{end}}>integer</option>
+				<option value="semver" {{if eq .ArgType "semver"}}selected{{end}}>semver</option>
+				<option value="sha" {{if eq .ArgType "sha"}}selected{{end}}>hex SHA</option>
+				<option value="ticket" {{if eq .ArgType "ticket"}}selected{{end}}>ticket ID (ABC-123)</option>
+				<option value="regex" {{if eq .ArgType "regex"}}selected{{end}}>custom regex</option>
+			</select> (<a href="/help/#constraints">?</a>)
+			<input type="text" name="arg_regex" id="arg_regex" value="{{.ArgRegex}}" placeholder="Regex (custom regex only)" autocomplete="off" {{.Checkbox}}>
+			<input type="text" name="arg_alternate" id="arg_alternate" value="{{.ArgAlternate}}" placeholder="Keyword when the option doesn't match" autocomplete="off" {{.Checkbox}}>
+			</p>
+			<p>
+			<label for="alias_days">When renamed, keep the old keyword working for</label>
+			<input type="number" name="alias_days" id="alias_days" value="{{.AliasDays}}" min="0" style="width: 60px;"> days (<a href="/help/#rename">?</a>)
+			</p>
 			<button type="submit">Save</button></p>
 			<button type="button" onclick="goToIndex()">Cancel</button>
 		</form>
@@ -922,8 +1672,45 @@ func handleMod(w http.ResponseWriter, r *http.Request) {
 		  // Enable the checkbox if the URL contains "%s"
 		  const value = textField.value	;
 		  singleword.disabled = !value.includes('%s');
+		  arg_type.disabled = !value.includes('%s');
+		  arg_regex.disabled = !value.includes('%s');
+		  arg_alternate.disabled = !value.includes('%s');
 		});
 		</script>
+		</div>
+
+		<div id="history" style="display: none;">
+		<table class="links">
+			<tr>
+				<th style="text-align: center; width: 150px">When</th>
+				<th style="text-align: center; width: 80px">Change</th>
+				<th style="text-align: center; width: 150px">By</th>
+				<th style="text-align: left;">Diff</th>
+				<th style="text-align: center; width: 80px">Revert</th>
+			</tr>
+			{{range .History}}
+			<tr>
+				<td style="text-align: center;" title="{{.When}}">{{.Age}}</td>
+				<td style="text-align: center;">{{.Action}}</td>
+				<td style="text-align: center;">{{if .Actor}}{{.Actor}}{{else}}-{{end}}</td>
+				<td>
+					{{range .Changes}}
+					{{.Field}}: {{if .Before}}<del><code>{{.Before}}</code></del>{{end}} → {{if .After}}<ins><code>{{.After}}</code></ins>{{else}}<i>empty</i>{{end}}<br>
+					{{end}}
+				</td>
+				<td style="text-align: center;">
+					{{if .Revertable}}
+					<form action="/revert/{{.ID}}" method="post" style="display: inline;">
+						<button type="submit" title="Go back to this version" onclick="return confirm('Go back to this version?')">↩️</button>
+					</form>
+					{{end}}
+				</td>
+			</tr>
+			{{else}}
+			<tr><td colspan="5">No changes recorded yet, links are tracked from their first edit after the upgrade.</td></tr>
+			{{end}}
+		</table>
+		</div>
 
 	</body>
 	</html>
@@ -933,7 +1720,7 @@ func handleMod(w http.ResponseWriter, r *http.Request) {
 	tmplParsed.Execute(w, item)
 }
 
-func handleModPost(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleModPost(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Path[len("/mod-post/"):]
 	if name == "" {
 		http.Error(w, "Keyword is required to modify a link.", http.StatusBadRequest)
@@ -953,22 +1740,86 @@ func handleModPost(w http.ResponseWriter, r *http.Request) {
 		singlewordvalue = 0
 	}
 
-	if newName == "" || url == "" {
-		http.Error(w, "Keyword and URL cannot be empty.", http.StatusBadRequest)
+	arg_type := r.FormValue("arg_type")
+	arg_regex := r.FormValue("arg_regex")
+	arg_alternate := r.FormValue("arg_alternate")
+
+	// Same rules as the add form
+	reserved, err := s.reservedKeywords()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	vars, err := s.store.Variables()
+	if err != nil {
+		http.Error(w, "Failed to fetch variables.", http.StatusInternalServerError)
+		return
+	}
+	err = validateLink(Link{Name: newName, URL: url, Singleword: singlewordvalue, ArgType: arg_type, ArgRegex: arg_regex}, reserved, vars)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if arg_type != "regex" {
+		arg_regex = ""
+	}
+	if arg_type == "" {
+		arg_alternate = ""
+	}
+
+	// Number of days the old keyword keeps working after a rename
+	alias_days := 0
+	if r.FormValue("alias_days") != "" {
+		alias_days, err = strconv.Atoi(r.FormValue("alias_days"))
+		if err != nil || alias_days < 0 {
+			http.Error(w, "The transition period must be a positive number of days.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var alias_until time.Time
+	if alias_days > 0 {
+		alias_until = time.Now().AddDate(0, 0, alias_days)
+	}
+
+	previous, err := s.store.GetLink(name)
+	if err != nil {
+		http.Error(w, "Keyword not found.", http.StatusNotFound)
 		return
 	}
+	if !strings.EqualFold(newName, previous.Name) {
+		_, err := s.store.GetLink(newName)
+		if err == nil {
+			http.Error(w, "This keyword is already used by another link.", http.StatusConflict)
+			return
+		}
+		if err != ErrNotFound {
+			http.Error(w, "Failed to check the keyword.", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// Update the link in the database
-	_, err := db.Exec("UPDATE items SET name = ?, url = ?, singleword = ? WHERE name = ?", newName, url, singlewordvalue, name)
+	link := Link{
+		Name:         newName,
+		URL:          url,
+		Singleword:   singlewordvalue,
+		ArgType:      arg_type,
+		ArgRegex:     arg_regex,
+		ArgAlternate: arg_alternate,
+		UpdatedAt:    time.Now(),
+	}
+	err = s.store.UpdateLink(name, link, alias_until, getActor(r))
 	if err != nil {
 		http.Error(w, "Failed to update the link.", http.StatusInternalServerError)
 		return
 	}
+	s.audit(r, "link.update", name, linkJSON(previous), linkJSON(link))
 
 	http.Redirect(w, r, "/?modified=" + newName, http.StatusSeeOther)
 }
 
-func handleDel(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleDel(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Path[len("/del/"):]
 	if name == "" {
 		http.Error(w, "Keyword is required to delete a link.", http.StatusBadRequest)
@@ -983,11 +1834,15 @@ func handleDel(w http.ResponseWriter, r *http.Request) {
 		Checkbox string
 	}
 
-	err := db.QueryRow("SELECT id, name, url, singleword FROM items WHERE LOWER(name) = LOWER(?)", name).Scan(&item.ID, &item.Name, &item.URL, &item.Singleword)
+	link, err := s.store.GetLink(name)
 	if err != nil {
 		http.Error(w, "Keyword not found.", http.StatusNotFound)
 		return
 	}
+	item.ID = link.ID
+	item.Name = link.Name
+	item.URL = link.URL
+	item.Singleword = link.Singleword
 
 	// Render the edit page
 	tmpl := `
@@ -1022,28 +1877,70 @@ func handleDel(w http.ResponseWriter, r *http.Request) {
 	tmplParsed.Execute(w, item)
 }
 
-func handleDelPost(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleDelPost(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Path[len("/del-post/"):]
 	if name == "" {
 		http.Error(w, "Keyword is required to modify a link.", http.StatusBadRequest)
 		return
 	}
 
-	// Delete the entry
-	_, err := db.Exec("DELETE FROM items WHERE name = LOWER(?);", name)
+	link, err := s.store.GetLink(name)
+	if err != nil {
+		http.Error(w, "Keyword not found.", http.StatusNotFound)
+		return
+	}
+
+	// Move the entry to the trash, its deprecated names go away
+	err = s.store.DeleteLink(name, getActor(r))
+	if err == ErrNotFound {
+		http.Error(w, "Keyword not found.", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to delete the link.", http.StatusInternalServerError)
 		return
 	}
+	s.audit(r, "link.delete", name, linkJSON(link), "")
 
 	http.Redirect(w, r, "/?deleted=" + name, http.StatusSeeOther)
 }
 
-func handleFallback(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleAliasDel(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path[len("/alias-del/"):]
+	if name == "" {
+		http.Error(w, "Keyword is required to remove a deprecated keyword.", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	before := ""
+	if alias, err := s.store.GetAlias(name, time.Now()); err == nil {
+		before = alias.Name + " → " + alias.Target
+	}
+
+	err := s.store.DeleteAlias(name)
+	if err == ErrNotFound {
+		http.Error(w, "Deprecated keyword not found.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to remove the deprecated keyword.", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "alias.delete", name, before, "")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *server) handleFallback(w http.ResponseWriter, r *http.Request) {
 	var item struct {
 		Value string
 	}
-	err := db.QueryRow("SELECT value FROM settings WHERE setting='fallback_url'").Scan(&item.Value)
+	value, err := s.store.GetSetting("fallback_url")
+	item.Value = value
 	if err != nil {
 		http.Error(w, "Fallback URL not found.", http.StatusNotFound)
 		return
@@ -1144,24 +2041,16 @@ func handleFallback(w http.ResponseWriter, r *http.Request) {
 	tmplParsed.Execute(w, item)
 }
 
-func handleFallbackPost(w http.ResponseWriter, r *http.Request) {
-	// Get updated fallback URL from the form
+func (s *server) handleFallbackPost(w http.ResponseWriter, r *http.Request) {
+	// Get updated fallback URL from the form, it needs exactly one placeholder
 	url := r.FormValue("url")
-	if url == "" {
-		http.Error(w, "Fallback URL cannot be empty.", http.StatusBadRequest)
+	if err := s.validateSetting("fallback_url", url, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
-	} 
-
-	// Max one placeholder in URL
-	placeholder_count := strings.Count(url, "{searchTerms}")
-
-	if placeholder_count != 1 {
-		http.Error(w, "You need exactly one {searchTerms} in your fallback URL.", http.StatusMethodNotAllowed)
-		return
-	} 
+	}
 
 	// Update the fallback URL in the database
-	_, err := db.Exec("UPDATE settings SET value = ? WHERE setting='fallback_url'", url)
+	err := s.setSetting(r, "fallback_url", url)
 	if err != nil {
 		http.Error(w, "Failed to update fallback URL.", http.StatusInternalServerError)
 		return
@@ -1170,28 +2059,298 @@ func handleFallbackPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/?fallback=updated", http.StatusSeeOther)
 }
 
-func handleClear(w http.ResponseWriter, r *http.Request) {
-	db.Exec("DELETE FROM queries WHERE 1 == 1")
+func (s *server) handleTrusted(w http.ResponseWriter, r *http.Request) {
+	var item struct {
+		Value string
+	}
+	value, err := s.store.GetSetting("trusted_domains")
+	item.Value = value
+	if err != nil {
+		http.Error(w, "Trusted domains not found.", http.StatusNotFound)
+		return
+	}
+
+	// Render the edit page
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	    <script>
+        function goToIndex() {
+            window.location.href = "/";
+        }
+    </script>
+	</head>
+	<body>
+		<h2><a href="/">Configure trusted domains</a></h2>
+		<form action="/trusted-post/" method="post">
+			<textarea name="domains" rows="10" cols="50" placeholder="example.org">{{.Value}}</textarea></p>
+			<button type="submit">Save</button></p>
+			<button type="button" onclick="goToIndex()">Cancel</button>
+		</form>
+		One domain per line. Subdomains are trusted too: <code>example.org</code> covers <code>wiki.example.org</code>.</p>
+		Shortcuts and searches leading anywhere else show a warning page before redirecting (<a href="/help/#trusted">?</a>).</p>
+		Leave empty to trust every destination.
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("edit").Parse(tmpl))
+	tmplParsed.Execute(w, item)
+}
+
+func (s *server) handleTrustedPost(w http.ResponseWriter, r *http.Request) {
+	// Store the domains one per line, whatever separators were used
+	domains := strings.Join(parseTrustedDomains(r.FormValue("domains")), "\n")
+
+	err := s.setSetting(r, "trusted_domains", domains)
+	if err != nil {
+		http.Error(w, "Failed to update trusted domains.", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/?trusted=updated", http.StatusSeeOther)
+}
+
+// addShortLink stores a long URL under a generated key and returns the key. Another
+// request can take the key between its check and the insert, a new key is tried then.
+func (s *server) addShortLink(url string, owner string) (string, error) {
+	for attempt := 0; ; attempt++ {
+		key, err := s.generateShortKey()
+		if err != nil {
+			return "", err
+		}
+
+		err = s.store.AddLink(Link{Name: key, URL: url, Owner: owner, UpdatedAt: time.Now(), Generated: 1})
+		if err == ErrTaken && attempt < 5 {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return key, nil
+	}
+}
+
+func (s *server) handleShort(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	url := r.FormValue("url")
+	if !isWebURL(url) {
+		http.Error(w, "A URL starting with http is required.", http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.addShortLink(url, getActor(r))
+	if err != nil {
+		http.Error(w, "Failed to shorten the link: " + err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "short.create", key, "", url)
+
+	http.Redirect(w, r, "/short/" + key, http.StatusSeeOther)
+}
+
+func (s *server) handleShortResult(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path[len("/short/"):]
+	if name == "" {
+		http.Error(w, "Key is required to show a short link.", http.StatusBadRequest)
+		return
+	}
+
+	var item struct {
+		Name    string
+		URL     string
+		ShortURL string
+	}
+	link, err := s.store.GetLink(name)
+	if err != nil || link.Generated != 1 {
+		http.Error(w, "Short link not found.", http.StatusNotFound)
+		return
+	}
+	item.Name = link.Name
+	item.URL = link.URL
+	item.ShortURL = getBaseURL(r) + "/go/?q=" + neturl.QueryEscape(item.Name)
+
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks - Short link</title>
+		<link rel="stylesheet" href="/static/style.css">
+		<script>
+		function goToIndex() {
+			window.location.href = "/";
+		}
+		function copyShortURL() {
+			navigator.clipboard.writeText(document.getElementById('short').value)
+				.then(() => document.getElementById('copied').style.display = 'inline');
+		}
+		</script>
+	</head>
+	<body>
+		<h2><a href="/">Your short link is <code>{{.Name}}</code></a></h2>
+		<input type="text" id="short" value="{{.ShortURL}}" size="50" readonly>
+		<button type="button" onclick="copyShortURL()">📋 Copy</button> <span id="copied" style="display: none;">Copied!</span></p>
+		It takes you to <a href="{{.URL}}" target="_blank">{{.URL}}</a></p>
+		<button type="button" onclick="goToIndex()">Back</button>
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("short").Parse(tmpl))
+	tmplParsed.Execute(w, item)
+}
+
+func (s *server) handleShortPrune(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days, err := strconv.Atoi(r.FormValue("days"))
+	if err != nil || days < 0 {
+		http.Error(w, "The age must be a positive number of days.", http.StatusBadRequest)
+		return
+	}
+	before := time.Now().AddDate(0, 0, -days)
+
+	// Only generated links are ever pruned
+	pruned, err := s.store.PruneShortLinks(before, r.FormValue("unused") == "on")
+	if err != nil {
+		http.Error(w, "Failed to prune short links.", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "short.prune", "", "", fmt.Sprintf("%d short links older than %d days deleted", pruned, days))
+
+	http.Redirect(w, r, fmt.Sprintf("/?pruned=%d", pruned), http.StatusSeeOther)
+}
+
+func (s *server) handleShortener(w http.ResponseWriter, r *http.Request) {
+	var item struct {
+		Alphabet string
+		Length   string
+	}
+	var err error
+	item.Alphabet, err = s.store.GetSetting("short_alphabet")
+	if err != nil {
+		http.Error(w, "Short link alphabet not found.", http.StatusNotFound)
+		return
+	}
+	item.Length, err = s.store.GetSetting("short_length")
+	if err != nil {
+		http.Error(w, "Short link length not found.", http.StatusNotFound)
+		return
+	}
+
+	// Render the edit page
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	    <script>
+        function goToIndex() {
+            window.location.href = "/";
+        }
+    </script>
+	</head>
+	<body>
+		<h2><a href="/">Configure URL shortener</a></h2>
+		<form action="/shortener-post/" method="post">
+			<label for="alphabet">Alphabet</label>
+			<input type="text" name="alphabet" id="alphabet" value="{{.Alphabet}}" required autocomplete="off"></p>
+			<label for="length">Key length</label>
+			<input type="number" name="length" id="length" value="{{.Length}}" min="1" max="32" required></p>
+			<button type="submit">Save</button></p>
+			<button type="button" onclick="goToIndex()">Cancel</button>
+		</form>
+		The default alphabet leaves out look-alike characters (<code>0 o 1 l i</code>) so keys are easy to read out loud.
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("edit").Parse(tmpl))
+	tmplParsed.Execute(w, item)
+}
+
+func (s *server) handleShortenerPost(w http.ResponseWriter, r *http.Request) {
+	alphabet := r.FormValue("alphabet")
+	length := r.FormValue("length")
+
+	err := s.validateSetting("short_alphabet", alphabet, nil)
+	if err == nil {
+		err = s.validateSetting("short_length", length, nil)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.setSetting(r, "short_alphabet", alphabet)
+	if err != nil {
+		http.Error(w, "Failed to update URL shortener.", http.StatusInternalServerError)
+		return
+	}
+	err = s.setSetting(r, "short_length", length)
+	if err != nil {
+		http.Error(w, "Failed to update URL shortener.", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/?shortener=updated", http.StatusSeeOther)
+}
+
+func (s *server) handleClear(w http.ResponseWriter, r *http.Request) {
+	// The history itself isn't kept, it can be large and says little about the change
+	cleared, err := s.store.ClearQueries()
+	if err != nil {
+		http.Error(w, "Failed to clear the history.", http.StatusInternalServerError)
+		return
+	}
+	if cleared > 0 {
+		s.audit(r, "history.clear", "", fmt.Sprintf("%d queries", cleared), "0 queries")
+	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func handleReserved(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleReserved(w http.ResponseWriter, r *http.Request) {
 	var item struct {
 		Add string
         Mod string
         Del string
+        Short string
 	}
-	err := db.QueryRow("SELECT value FROM settings WHERE setting='keyword_add'").Scan(&item.Add)
+	var err error
+	item.Add, err = s.store.GetSetting("keyword_add")
 	if err != nil {
 		http.Error(w, "Reserved URL not found.", http.StatusNotFound)
 		return
 	}
-	err = db.QueryRow("SELECT value FROM settings WHERE setting='keyword_mod'").Scan(&item.Mod)
+	item.Mod, err = s.store.GetSetting("keyword_mod")
 	if err != nil {
 		http.Error(w, "Reserved URL not found.", http.StatusNotFound)
 		return
 	}
-    err = db.QueryRow("SELECT value FROM settings WHERE setting='keyword_del'").Scan(&item.Del)
+    item.Del, err = s.store.GetSetting("keyword_del")
+	if err != nil {
+		http.Error(w, "Reserved URL not found.", http.StatusNotFound)
+		return
+	}
+	item.Short, err = s.store.GetSetting("keyword_short")
 	if err != nil {
 		http.Error(w, "Reserved URL not found.", http.StatusNotFound)
 		return
@@ -1220,6 +2379,8 @@ func handleReserved(w http.ResponseWriter, r *http.Request) {
             <input type="text" name="mod" value="{{.Mod}}" required autocomplete="off"></p>
 			<label for="add">Delete shortcut</label>
             <input type="text" name="del" value="{{.Del}}" required autocomplete="off"></p>
+			<label for="add">Shorten URL</label>
+            <input type="text" name="short" value="{{.Short}}" required autocomplete="off"></p>
 			<button type="submit">Save</button></p>
 			<button type="button" onclick="goToIndex()">Cancel</button>
 		</form>
@@ -1232,24 +2393,47 @@ func handleReserved(w http.ResponseWriter, r *http.Request) {
 	tmplParsed.Execute(w, item)
 }
 
-func handleReservedPost(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleReservedPost(w http.ResponseWriter, r *http.Request) {
 	// Get updated reserved URL from the form
 	newAdd := r.FormValue("add")
 	newMod := r.FormValue("mod")
 	newDel := r.FormValue("del")
+	newShort := r.FormValue("short")
+
+	// Keywords left as they are aren't checked again, a link may have taken one since
+	current, err := s.reservedKeywords()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	keywords := map[string]string{"keyword_add": newAdd, "keyword_mod": newMod, "keyword_del": newDel, "keyword_short": newShort}
+	for _, setting := range reservedSettings {
+		if keywords[setting] == current[setting] {
+			continue
+		}
+		if err := s.validateSetting(setting, keywords[setting], keywords); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Update the reserved URL in the database
-	_, err := db.Exec("UPDATE settings SET value = ? WHERE setting='keyword_add'", newAdd)
+	err = s.setSetting(r, "keyword_add", newAdd)
+	if err != nil {
+		http.Error(w, "Failed to update reserved keyword.", http.StatusInternalServerError)
+		return
+	}
+    err = s.setSetting(r, "keyword_mod", newMod)
 	if err != nil {
 		http.Error(w, "Failed to update reserved keyword.", http.StatusInternalServerError)
 		return
 	}
-    _, err = db.Exec("UPDATE settings SET value = ? WHERE setting='keyword_mod'", newMod)
+    err = s.setSetting(r, "keyword_del", newDel)
 	if err != nil {
 		http.Error(w, "Failed to update reserved keyword.", http.StatusInternalServerError)
 		return
 	}
-    _, err = db.Exec("UPDATE settings SET value = ? WHERE setting='keyword_del'", newDel)
+	err = s.setSetting(r, "keyword_short", newShort)
 	if err != nil {
 		http.Error(w, "Failed to update reserved keyword.", http.StatusInternalServerError)
 		return
@@ -1258,40 +2442,186 @@ func handleReservedPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/?reserved=updated", http.StatusSeeOther)
 }
 
-func handleBackup(w http.ResponseWriter, r *http.Request) {
-	err := backupFile()
+func (s *server) handleVariables(w http.ResponseWriter, r *http.Request) {
+	vars, err := s.store.Variables()
 	if err != nil {
-		log.Println("Backup failed with error:", err)
-		http.Error(w, "Backup failed: "+err.Error(), 500)
+		http.Error(w, "Failed to fetch variables.", http.StatusInternalServerError)
 		return
 	}
 
-	log.Println("Database backup success")
-	w.Write([]byte("Backup created successfully"))
+	var items []struct {
+		Name  string
+		Value string
+		Usage int
+	}
+	for name, value := range vars {
+		var item struct {
+			Name  string
+			Value string
+			Usage int
+		}
+		item.Name = name
+		item.Value = value
+
+		// Number of links a rename or deletion would affect
+		item.Usage, err = s.store.CountLinksContaining("${" + name + "}")
+		if err != nil {
+			http.Error(w, "Failed to count variable usage.", http.StatusInternalServerError)
+			return
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+
+	// Render the variables page
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	    <script>
+        function goToIndex() {
+            window.location.href = "/";
+        }
+    </script>
+	</head>
+	<body>
+		<h2><a href="/">Configure variables</a></h2>
+		Use <code>${NAME}</code> in destination URLs, for example <code>https://${JIRA}/browse/%s</code> (<a href="/help/#variables">?</a>)</p>
+		<table class="links">
+			<tr>
+				<th style="text-align: left; width: 150px">Name</th>
+				<th>Value</th>
+				<th style="text-align: center; width: 100px">Used by</th>
+				<th style="text-align: center; width: 150px">Management</th>
+			</tr>
+			{{range .}}
+			<tr>
+				<td><input type="text" name="name" value="{{.Name}}" form="var-{{.Name}}" required autocomplete="off"></td>
+				<td><input type="text" name="value" value="{{.Value}}" form="var-{{.Name}}" required autocomplete="off" style="width: 100%;"></td>
+				<td style="text-align: center;">{{.Usage}} links</td>
+				<td style="text-align: center;">
+					<form id="var-{{.Name}}" action="/variables-post/" method="post" style="display: inline;">
+						<input type="hidden" name="old_name" value="{{.Name}}">
+						<button type="submit" title="Save variable" {{if .Usage}}onclick="return confirm('Changes apply to {{.Usage}} links. Continue?')"{{end}}>Save</button>
+					</form>
+					<form action="/variables-del/{{.Name}}" method="post" style="display: inline;">
+						<button type="submit" title="Delete variable" {{if .Usage}}onclick="return confirm('{{.Usage}} links use this variable. Delete anyway?')"{{end}}>❌</button>
+					</form>
+				</td>
+			</tr>
+			{{end}}
+		</table>
+		</p>
+		<form action="/variables-post/" method="post">
+			<input type="text" name="name" placeholder="New variable name (ex: JIRA)" required autocomplete="off">
+			<input type="text" name="value" placeholder="Value (ex: jira.corp.example)" required autocomplete="off">
+			<button type="submit">Add variable</button></p>
+			<button type="button" onclick="goToIndex()">Cancel</button>
+		</form>
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("variables").Parse(tmpl))
+	tmplParsed.Execute(w, items)
 }
 
-func backupFile() error {
-	srcFile := "/data/items.db"
-	timestamp := time.Now().Format("20060102_150405")
-	destFile := fmt.Sprintf("/data/items.db.%s", timestamp)
+func (s *server) handleVariablesPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// old_name is empty when adding a variable
+	oldName := r.FormValue("old_name")
+	name := r.FormValue("name")
+	value := r.FormValue("value")
+	if name == "" || value == "" {
+		http.Error(w, "Variable name and value cannot be empty.", http.StatusBadRequest)
+		return
+	}
+	if !variableName.MatchString(name) {
+		http.Error(w, "Variable names can only contain letters, digits and underscores.", http.StatusBadRequest)
+		return
+	}
+
+	if oldName == "" {
+		err := s.store.AddVariable(name, value)
+		if err != nil {
+			http.Error(w, "Failed to add variable. Ensure the name is unique.", http.StatusInternalServerError)
+			return
+		}
+		s.audit(r, "variable.create", name, "", value)
+	} else {
+		vars, err := s.store.Variables()
+		if err != nil {
+			http.Error(w, "Failed to fetch variables.", http.StatusInternalServerError)
+			return
+		}
 
-	src, err := os.Open(srcFile)
+		fallback, err := s.store.GetSetting("fallback_url")
+		if err != nil && err != ErrNotFound {
+			http.Error(w, "Failed to fetch settings.", http.StatusInternalServerError)
+			return
+		}
+
+		// A rename follows through to the links and the fallback URL using the variable
+		err = s.store.UpdateVariable(oldName, name, value)
+		if err == ErrNotFound {
+			http.Error(w, "Variable not found.", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update variable. Ensure the name is unique.", http.StatusInternalServerError)
+			return
+		}
+		s.audit(r, "variable.update", name, oldName+" = "+vars[oldName], name+" = "+value)
+		if renamed, err := s.store.GetSetting("fallback_url"); err == nil && renamed != fallback {
+			s.audit(r, "setting.update", "fallback_url", fallback, renamed)
+		}
+	}
+
+	http.Redirect(w, r, "/?variables=updated", http.StatusSeeOther)
+}
+
+func (s *server) handleVariablesDel(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path[len("/variables-del/"):]
+	if name == "" {
+		http.Error(w, "Variable name is required to delete a variable.", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars, err := s.store.Variables()
 	if err != nil {
-		return err
+		http.Error(w, "Failed to fetch variables.", http.StatusInternalServerError)
+		return
 	}
-	defer src.Close()
 
-	dst, err := os.Create(destFile)
+	err = s.store.DeleteVariable(name)
+	if err == ErrNotFound {
+		http.Error(w, "Variable not found.", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		return err
+		http.Error(w, "Failed to delete variable.", http.StatusInternalServerError)
+		return
 	}
-	defer dst.Close()
+	s.audit(r, "variable.delete", name, vars[name], "")
 
-	_, err = io.Copy(dst, src)
-	return err
+	http.Redirect(w, r, "/?variables=updated", http.StatusSeeOther)
 }
 
-func handleHelp(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleHelp(w http.ResponseWriter, r *http.Request) {
 	// Define the HTML content as a template
 	tmpl := template.Must(template.New("static").Parse(`
 	<!DOCTYPE html>
@@ -1306,9 +2636,9 @@ func handleHelp(w http.ResponseWriter, r *http.Request) {
 
 	<h2><a href="/">GoMarks Help</a></h2>
 
-	<a href="/help/#simple">Simple shortcuts</a> | <a href="/help/#smart">Smart shortcuts</a> | <a href="/help/#smarter">Smarter shortcuts</a> | <a href="/help/#reserved">Reserved action keywords</a>
+	<a href="/help/#simple">Simple shortcuts</a> | <a href="/help/#smart">Smart shortcuts</a> | <a href="/help/#smarter">Smarter shortcuts</a> | <a href="/help/#constraints">Option constraints</a> | <a href="/help/#reserved">Reserved action keywords</a>
 	<br>
-	<a href="/help/#browser">GoMarks as your search engine (Firefox/Chrome/Safari/iPhone)</a> | <a href="/help/#fallback">Fallback search engine</a> | <a href="/help/#backup">Backup database</a>
+	<a href="/help/#browser">GoMarks as your search engine (Firefox/Chrome/Safari/iPhone)</a> | <a href="/help/#fallback">Fallback search engine</a> | <a href="/help/#variables">Variables</a> | <a href="/help/#trusted">Trusted domains</a> | <a href="/help/#shortener">URL shortener</a> | <a href="/help/#backup">Backup database</a>
 <br><br><br>
 
 	The general idea of GoMarks is to become your default search engine.</p>
@@ -1395,6 +2725,28 @@ func handleHelp(w http.ResponseWriter, r *http.Request) {
 
 	When single option is enabled, an icon 1️⃣ appears next to the keyword in the shortcuts list.</p>
 
+	<h4 id="constraints">Option constraints</h4>
+
+	Shortcuts with a placeholder can require their option to look a certain way, for example an integer, a semantic version, a hex commit SHA or a ticket ID like <code>OPS-1234</code>.</p>
+
+	You can also write your own regular expression. It has to match the whole option.</p>
+
+	When the option doesn't match, GoMarks doesn't build the destination URL. It makes a <a href="/help/#fallback">search engine</a> request instead, or uses the alternate keyword you picked.</p>
+
+	Let's say <code>pr</code> takes you to <code>https://github.com/sebw/gomarks/pull/<span style="background-color:#bf616a;">%s</span></code> with the integer constraint and <code>ghsearch</code> as alternate keyword.</p>
+
+	<code>pr 42</code> opens pull request 42, <code>pr dark mode</code> searches GitHub with <code>ghsearch dark mode</code>.</p>
+
+	Constrained shortcuts show a 🎯 icon next to the keyword in the shortcuts list.</p>
+
+	<h4 id="rename">Renaming shortcuts</h4>
+
+	When you rename a shortcut on its edit page, the old keyword keeps working for a transition period (30 days by default, 0 to drop it immediately).</p>
+
+	Using the old keyword shows a short "this link moved" notice naming the new keyword before redirecting.</p>
+
+	Deprecated keywords are listed on the main page with the number of times they have been used since the rename, so you know when it's safe to let them go.</p>
+
 	<h4>Shortcut examples</h4>
 
 	<table class="links">
@@ -1476,6 +2828,10 @@ func handleHelp(w http.ResponseWriter, r *http.Request) {
 		<td><code>!del myshortcut</code></td>
 		<td>takes you to delete confirmation page</td>
 	</tr>
+	<tr>
+		<td><code>!short https://www.example.com/a/very/long/url</code></td>
+		<td>creates a <a href="/help/#shortener">short link</a> with a generated key</td>
+	</tr>
 	</table>
 
 	<br>
@@ -1534,15 +2890,103 @@ func handleHelp(w http.ResponseWriter, r *http.Request) {
 
 	The fallback search engine is <a href="/fallback">configurable</a> (Google, Duckduckgo, your own self-hosted solution, etc.)</p>
 	
+	<h2 id="variables">Variables</h3>
+
+	Variables hold values shared by many shortcuts, like the hostname of your ticketing system.</p>
+
+	Create a variable <code>JIRA</code> with the value <code>jira.corp.example</code> on the <a href="/variables">variables page</a>, then use it in destination URLs: <code>https://<span style="background-color:#bf616a;">${JIRA}</span>/browse/%s</code>.</p>
+
+	When the host moves, update the variable once and every shortcut follows.</p>
+
+	The variables page shows how many shortcuts use each variable. Renaming a variable also renames it in those shortcuts.</p>
+
+	Variables work in the fallback search engine URL too.</p>
+
+	<h2 id="trusted">Trusted domains</h3>
+
+	On a shared instance, anyone can point a shortcut anywhere. A compromised or sloppy shortcut can send your colleagues to a phishing page.</p>
+
+	You can <a href="/trusted">configure trusted domains</a>. Shortcuts and fallback searches leading outside of them show a warning page first, naming the destination, the owner of the shortcut and when it was last edited.</p>
+
+	The owner is the user name passed by your authenticating reverse proxy (<code>Remote-User</code>, <code>X-Forwarded-User</code>, <code>X-Authentik-Username</code>...) when the shortcut was created.</p>
+
+	Remember to trust the domain of your fallback search engine if you don't want a warning on every search.</p>
+
+	<h2 id="shortener">URL shortener</h3>
+
+	GoMarks can shorten long URLs you want to share, without coming up with a keyword.</p>
+
+	Use the "Shorten" form on the main page or <code>!short https://www.example.com/a/very/long/url</code> in your browser bar.</p>
+
+	The link is stored under a generated key like <code>k7xq2</code>, shown with a copy button: <code>{{.BaseURL}}/go/?q=k7xq2</code>.</p>
+
+	Keys never collide with existing shortcuts or reserved keywords. The <a href="/shortener">alphabet and key length</a> are configurable.</p>
+
+	Short links are listed apart from your shortcuts on the main page, and can be pruned by age.</p>
+
+	<h2 id="trash">Trash</h3>
+
+	Deleted shortcuts go to the <a href="/trash">trash</a>, along with who deleted them and when. Their keyword is free for a new shortcut right away.</p>
+
+	A shortcut restored from the trash keeps its visit count. Shortcuts are purged from the trash after 30 days, you can change the delay or set 0 to keep them until you delete them by hand.</p>
+
+	<h2 id="history">History</h3>
+
+	Every creation, edit, deletion and restore of a shortcut is recorded with who made it, from the same reverse proxy headers as the owner. The History tab of the edit page shows what changed in each revision, and ↩️ brings the shortcut back to how a revision left it.</p>
+
+	<h2 id="transfer">Export and import</h3>
+
+	The <a href="/import">export and import</a> page downloads your shortcuts, with their counters, your settings and variables as a JSON or YAML file, and imports such a file on another instance. Before anything is imported, a preview shows the new shortcuts and the keywords that exist with another URL, and you choose for each of them to skip it, overwrite the existing shortcut, import it under a new keyword like <code>gh-2</code>, or only add its counter to the existing one.</p>
+
+	<pre><code>curl -o gomarks.yaml '{{.BaseURL}}/export?format=yaml'
+curl -F file=@gomarks.yaml -H 'Accept: application/json' {{.BaseURL}}/import-post</code></pre>
+
+	The format is documented in the README.</p>
+
+	Links can also be exported as CSV for spreadsheets, and imported back. Columns are found by their header (<code>name</code> or <code>keyword</code>, <code>url</code> or <code>link</code>...), or by the headers you give in the import form. Rows the add form would refuse are left out, the report tells which and why.</p>
+
+	Bookmark files exported by browsers import the same way. Firefox keywords are kept, other bookmarks get a keyword made from their folder and title, like <code>dev-github</code>. The links also export as a bookmark file, for any browser.</p>
+
+	To migrate the keywords of Chrome or Firefox, import a copy of the <code>Web Data</code> file of your Chrome profile, or of <code>places.sqlite</code> of your Firefox profile. The same works on the command line with <code>-import</code>, see the README.</p>
+
+	<h2 id="audit">Audit log</h3>
+
+	Every change made through GoMarks is recorded in the <a href="/audit">audit log</a>: shortcuts, settings, reserved keywords, variables, counter resets, history clearing, backups and restores. Each entry has who made the change, from which IP address, when, and the values before and after.</p>
+
+	The user comes from the headers of your authenticating reverse proxy, the IP address from <code>X-Forwarded-For</code> or <code>X-Real-IP</code> when set. The log is append-only, the database rejects any change or deletion of its entries, and a restore keeps what was recorded since the backup.</p>
+
+	The page filters by user, action (<code>link.</code>, <code>setting.update</code>...), text and dates. <code>/audit.json</code> takes the same filters and exports the matching entries:</p>
+
+	<pre><code>curl -o audit.json '{{.BaseURL}}/audit.json?action=setting.&since=2024-01-01'</code></pre>
+
 	<h2 id="backup">Backup database</h3>
 
 	<p>You can trigger a backup via the button on the main page or via:</p>
 
 	<code>curl -X POST {{.BaseURL}}/backup</code></br>
 	</br>
-	The database will be saved on the filesystem in the format <code>items.db.timestamp</code>.</br>
+	To keep a copy off the server, download a snapshot instead, optionally compressed with gzip. It is as consistent as the backups written on the server, which makes it suitable for a cron job on another machine:</p>
+
+	<code>curl -OJ {{.BaseURL}}/backup-download</code></br>
+	<code>curl -OJ "{{.BaseURL}}/backup-download?gzip=1"</code></br>
+	</br>
+	The database will be saved on the filesystem in the format <code>items.db.timestamp</code>, in the directory of the database unless <code>-backup-dir</code> says otherwise.
+	The copy is consistent even while GoMarks is in use, and is checked for corruption before the backup is reported as successful.</br>
 	</br>
-	You can restore the database by manually replacing <code>items.db</code> with the backup copy.
+	To restore a backup, pick it on the <a href="/backups">backups page</a> or upload a file there. GoMarks checks the file, shows which shortcuts would be added, removed or changed, and takes a backup of the current database before replacing it. No restart is needed.
+	From the command line, upload a file (the answer redirects to the review page of the stored backup) and restore a backup by name:</p>
+
+	<code>curl -F file=@items.db.20250101_120000 {{.BaseURL}}/restore-upload</code></br>
+	<code>curl -X POST {{.BaseURL}}/restore-post/items.db.20250101_120000</code></p>
+
+	<p>The <a href="/backups">backups page</a> lists the existing backups with their size and age, and lets you delete them.
+	Backups can also be taken on a schedule, hourly or daily. After each backup taken with the button or on schedule, old backups are pruned grandfather-father-son style: the newest backup of each of the last N days and of each of the last M weeks are kept, along with the newest backup.
+	Keep 0 daily and 0 weekly backups to never prune. Uploaded files end with <code>.upload</code> and are never pruned, delete them from the backups page once restored.</p>
+
+	<p>When GoMarks is started with a backup passphrase or key file, backups written on the server and downloaded ones are encrypted with AES-256-GCM. Encrypted downloads end with <code>.enc</code>. Restoring an encrypted backup decrypts it with the same passphrase or key file, and uploads can be encrypted too.
+	Keep the passphrase or key file somewhere else than the backups: without it, they can't be restored.</p>
+
+	<p>When an S3-compatible bucket is configured, every backup taken with the button or on schedule is also copied there, and old copies are pruned with the same policy.</p>
 	
 	<br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br><br>
 	🍌🐇<br><br>
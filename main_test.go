@@ -0,0 +1,381 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestServer returns a server on an in-memory store holding links.
+func newTestServer(t *testing.T, links ...Link) *server {
+	t.Helper()
+	store := newMemoryStore()
+	for _, link := range links {
+		if err := store.AddLink(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &server{store: store, imports: newPendingImports()}
+}
+
+// serve runs a request through the routes of s, with form as its POST body.
+func serve(s *server, method string, target string, form url.Values) *httptest.ResponseRecorder {
+	var r *http.Request
+	if form != nil {
+		r = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, target, nil)
+	}
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, r)
+	return w
+}
+
+func TestRedirect(t *testing.T) {
+	s := newTestServer(t,
+		Link{Name: "gh", URL: "https://github.com"},
+		Link{Name: "docker", URL: "https://hub.docker.com/_/%s", Singleword: 1},
+		Link{Name: "amzn", URL: "https://www.amazon.com/s?k=%s"},
+		Link{Name: "pr", URL: "https://github.com/pulls/%s", Singleword: 1, ArgType: "integer", ArgAlternate: "branch"},
+		Link{Name: "branch", URL: "https://github.com/tree/%s"},
+	)
+
+	for _, test := range []struct {
+		query    string
+		status   int
+		location string
+	}{
+		{"gh", http.StatusFound, "https://github.com"},
+		{"GH", http.StatusFound, "https://github.com"},
+		{"docker alpine", http.StatusFound, "https://hub.docker.com/_/alpine"},
+		{"docker alpine linux", http.StatusFound, "https://www.duckduckgo.com/?q=docker alpine linux"},
+		{"amzn usb cable", http.StatusFound, "https://www.amazon.com/s?k=usb cable"},
+		{"pr 1234", http.StatusFound, "https://github.com/pulls/1234"},
+		{"pr main", http.StatusFound, "https://github.com/tree/main"},
+		{"pr main dev", http.StatusFound, "https://www.duckduckgo.com/?q=pr main dev"},
+		{"unknown words", http.StatusFound, "https://www.duckduckgo.com/?q=unknown words"},
+		{"docker", http.StatusBadRequest, ""},
+		{"gh issues", http.StatusBadRequest, ""},
+		{"!mod gh", http.StatusSeeOther, "/mod/gh"},
+		{"!del gh", http.StatusSeeOther, "/del/gh"},
+	} {
+		w := serve(s, http.MethodGet, "/go/?q="+url.QueryEscape(test.query), nil)
+		if w.Code != test.status || w.Header().Get("Location") != test.location {
+			t.Errorf("%q answered %d to %q, want %d to %q", test.query, w.Code, w.Header().Get("Location"), test.status, test.location)
+		}
+	}
+
+	if w := serve(s, http.MethodGet, "/go/", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("empty query answered %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// Visits are counted under the keyword as it is stored
+	link, err := s.store.GetLink("gh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Count != 1 {
+		t.Errorf("gh count = %d, want 1", link.Count)
+	}
+}
+
+func TestRedirectUntrusted(t *testing.T) {
+	s := newTestServer(t, Link{Name: "ex", URL: "https://evil.example.net", Owner: "bob"})
+	if err := s.store.SetSetting("trusted_domains", "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(s, http.MethodGet, "/go/?q=ex", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "https://evil.example.net") || !strings.Contains(w.Body.String(), "bob") {
+		t.Errorf("untrusted destination answered %d with:\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestRedirectRenamedKeyword(t *testing.T) {
+	s := newTestServer(t, Link{Name: "gh", URL: "https://github.com"})
+	form := url.Values{"name": {"github"}, "url": {"https://github.com"}, "alias_days": {"30"}}
+	if w := serve(s, http.MethodPost, "/mod-post/gh", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("rename answered %d: %s", w.Code, w.Body.String())
+	}
+
+	w := serve(s, http.MethodGet, "/go/?q=gh", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "github") {
+		t.Errorf("old name answered %d with:\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestAdd(t *testing.T) {
+	s := newTestServer(t, Link{Name: "gh", URL: "https://github.com"})
+
+	form := url.Values{"name": {"docker"}, "url": {"https://hub.docker.com/_/%s"}, "singleword": {"on"}, "arg_type": {"integer"}, "arg_regex": {"ignored"}}
+	w := serve(s, http.MethodPost, "/add", form)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?added=docker" {
+		t.Fatalf("add answered %d to %q: %s", w.Code, w.Header().Get("Location"), w.Body.String())
+	}
+	link, err := s.store.GetLink("docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Singleword != 1 || link.ArgType != "integer" || link.ArgRegex != "" {
+		t.Errorf("added %+v", link)
+	}
+	entries, err := s.store.AuditLog(AuditFilter{Action: "link.create"})
+	if err != nil || len(entries) != 1 || entries[0].Target != "docker" {
+		t.Errorf("audit log = %v, %v", entries, err)
+	}
+
+	for _, test := range []struct {
+		form   url.Values
+		status int
+	}{
+		{url.Values{"name": {"gh"}, "url": {"https://gitlab.com"}}, http.StatusInternalServerError},
+		{url.Values{"name": {"!add"}, "url": {"https://example.com"}}, http.StatusBadRequest},
+		{url.Values{"name": {"js"}, "url": {"javascript:alert(1)"}}, http.StatusBadRequest},
+		{url.Values{"name": {"two"}, "url": {"https://example.com/%s/%s"}}, http.StatusBadRequest},
+		{url.Values{"name": {""}, "url": {"https://example.com"}}, http.StatusBadRequest},
+	} {
+		if w := serve(s, http.MethodPost, "/add", test.form); w.Code != test.status {
+			t.Errorf("adding %v answered %d, want %d", test.form, w.Code, test.status)
+		}
+	}
+	if w := serve(s, http.MethodGet, "/add", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /add answered %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	// The reserved keyword adds links from the search bar too
+	w = serve(s, http.MethodGet, "/go/?q="+url.QueryEscape("!add ji https://jira.example.com/browse/%s 1"), nil)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("!add answered %d: %s", w.Code, w.Body.String())
+	}
+	if link, err := s.store.GetLink("ji"); err != nil || link.Singleword != 1 {
+		t.Errorf("GetLink(ji) = %+v, %v", link, err)
+	}
+}
+
+func TestMod(t *testing.T) {
+	s := newTestServer(t,
+		Link{Name: "gh", URL: "https://github.com"},
+		Link{Name: "gl", URL: "https://gitlab.com"},
+	)
+	if err := s.store.IncrementCount("gh"); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"name": {"github"}, "url": {"https://github.com/search?q=%s"}}
+	w := serve(s, http.MethodPost, "/mod-post/gh", form)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?modified=github" {
+		t.Fatalf("mod answered %d to %q: %s", w.Code, w.Header().Get("Location"), w.Body.String())
+	}
+	link, err := s.store.GetLink("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.URL != "https://github.com/search?q=%s" || link.Count != 1 {
+		t.Errorf("modified link = %+v", link)
+	}
+	if _, err := s.store.GetLink("gh"); err != ErrNotFound {
+		t.Errorf("GetLink(gh) after the rename returned %v, want ErrNotFound", err)
+	}
+	// Without a transition period the old name goes away
+	if _, err := s.store.GetAlias("gh", link.UpdatedAt); err != ErrNotFound {
+		t.Errorf("GetAlias(gh) returned %v, want ErrNotFound", err)
+	}
+	revisions, err := s.store.LinkRevisions(link.ID)
+	if err != nil || len(revisions) != 2 {
+		t.Errorf("revisions = %v, %v, want create and update", revisions, err)
+	}
+
+	for _, test := range []struct {
+		target string
+		form   url.Values
+		status int
+	}{
+		{"/mod-post/github", url.Values{"name": {"gl"}, "url": {"https://github.com"}}, http.StatusConflict},
+		{"/mod-post/missing", url.Values{"name": {"missing"}, "url": {"https://example.com"}}, http.StatusNotFound},
+		{"/mod-post/github", url.Values{"name": {"!del"}, "url": {"https://github.com"}}, http.StatusBadRequest},
+		{"/mod-post/github", url.Values{"name": {"github"}, "url": {"https://github.com"}, "alias_days": {"-1"}}, http.StatusBadRequest},
+		{"/mod-post/github", url.Values{"name": {"github"}, "url": {"https://github.com/%s"}, "arg_type": {"regex"}, "arg_regex": {"("}}, http.StatusBadRequest},
+	} {
+		if w := serve(s, http.MethodPost, test.target, test.form); w.Code != test.status {
+			t.Errorf("%s with %v answered %d, want %d", test.target, test.form, w.Code, test.status)
+		}
+	}
+
+	// Changing only the case of a keyword is no conflict with itself
+	form = url.Values{"name": {"GitHub"}, "url": {"https://github.com"}}
+	if w := serve(s, http.MethodPost, "/mod-post/github", form); w.Code != http.StatusSeeOther {
+		t.Errorf("case change answered %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDel(t *testing.T) {
+	s := newTestServer(t, Link{Name: "gh", URL: "https://github.com"})
+
+	w := serve(s, http.MethodGet, "/del/gh", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `action="/del-post/gh"`) {
+		t.Errorf("delete page answered %d with:\n%s", w.Code, w.Body.String())
+	}
+
+	w = serve(s, http.MethodPost, "/del-post/GH", url.Values{})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?deleted=GH" {
+		t.Fatalf("delete answered %d to %q: %s", w.Code, w.Header().Get("Location"), w.Body.String())
+	}
+	if _, err := s.store.GetLink("gh"); err != ErrNotFound {
+		t.Errorf("GetLink(gh) after delete returned %v, want ErrNotFound", err)
+	}
+	trash, err := s.store.ListTrash()
+	if err != nil || len(trash) != 1 || trash[0].Name != "gh" {
+		t.Errorf("trash = %v, %v", trash, err)
+	}
+	entries, err := s.store.AuditLog(AuditFilter{Action: "link.delete"})
+	if err != nil || len(entries) != 1 || entries[0].Before == "" {
+		t.Errorf("audit log = %v, %v", entries, err)
+	}
+
+	// The keyword now goes to the fallback
+	w = serve(s, http.MethodGet, "/go/?q=gh", nil)
+	if w.Header().Get("Location") != "https://www.duckduckgo.com/?q=gh" {
+		t.Errorf("deleted keyword went to %q", w.Header().Get("Location"))
+	}
+
+	for _, target := range []string{"/del/gh", "/del-post/gh"} {
+		if w := serve(s, http.MethodPost, target, url.Values{}); w.Code != http.StatusNotFound {
+			t.Errorf("%s answered %d, want %d", target, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestRevert(t *testing.T) {
+	// Created before URLs had to be http(s), then fixed
+	s := newTestServer(t, Link{Name: "gh", URL: "ftp://github.com"})
+	form := url.Values{"name": {"gh"}, "url": {"https://github.com"}}
+	if w := serve(s, http.MethodPost, "/mod-post/gh", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("mod answered %d: %s", w.Code, w.Body.String())
+	}
+	link, err := s.store.GetLink("gh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := s.store.LinkRevisions(link.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]int)
+	for _, revision := range revisions {
+		ids[revision.Action] = revision.ID
+	}
+
+	w := serve(s, http.MethodPost, "/revert/"+strconv.Itoa(ids["create"]), url.Values{})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("revert to the ftp URL answered %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if link, err := s.store.GetLink("gh"); err != nil || link.URL != "https://github.com" {
+		t.Errorf("link after a refused revert = %+v, %v", link, err)
+	}
+
+	w = serve(s, http.MethodPost, "/revert/"+strconv.Itoa(ids["update"]), url.Values{})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?modified=gh" {
+		t.Errorf("revert answered %d to %q: %s", w.Code, w.Header().Get("Location"), w.Body.String())
+	}
+}
+
+func TestArgumentConstraints(t *testing.T) {
+	for _, test := range []struct {
+		argType  string
+		argRegex string
+		arg      string
+		want     bool
+	}{
+		{"", "", "anything goes", true},
+		{"integer", "", "1234", true},
+		{"integer", "", "12a", false},
+		{"semver", "", "v1.2.3", true},
+		{"semver", "", "1.2.3-rc.1+build.5", true},
+		{"semver", "", "1.2", false},
+		{"sha", "", "a1b2c3d", true},
+		{"sha", "", "a1b2c3", false},
+		{"sha", "", "g1b2c3d", false},
+		{"ticket", "", "OPS-42", true},
+		{"ticket", "", "42-OPS", false},
+		{"regex", "[a-z]+", "main", true},
+		// Patterns are anchored
+		{"regex", "[a-z]+", "main2", false},
+		{"regex", "a|b", "ab", false},
+		{"regex", "(", "(", false},
+		{"unknown", "", "1", false},
+	} {
+		if got := argumentMatches(test.argType, test.argRegex, test.arg); got != test.want {
+			t.Errorf("argumentMatches(%q, %q, %q) = %v, want %v", test.argType, test.argRegex, test.arg, got, test.want)
+		}
+	}
+
+	for _, test := range []struct {
+		url      string
+		argType  string
+		argRegex string
+		valid    bool
+	}{
+		{"https://example.com", "", "", true},
+		{"https://example.com/%s", "integer", "", true},
+		{"https://example.com", "integer", "", false},
+		{"https://example.com/%s", "regex", "[0-9]+", true},
+		{"https://example.com/%s", "regex", "", false},
+		{"https://example.com/%s", "regex", "[0-9", false},
+		{"https://example.com/%s", "uuid", "", false},
+	} {
+		err := validateArgConstraint(test.url, test.argType, test.argRegex)
+		if (err == nil) != test.valid {
+			t.Errorf("validateArgConstraint(%q, %q, %q) = %v, want valid %v", test.url, test.argType, test.argRegex, err, test.valid)
+		}
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	vars := map[string]string{"JIRA": "jira.example.com", "ORG": "acme"}
+	for _, test := range []struct {
+		url  string
+		want string
+	}{
+		{"https://${JIRA}/browse/%s", "https://jira.example.com/browse/%s"},
+		{"https://github.com/${ORG}/${ORG}", "https://github.com/acme/acme"},
+		{"https://${MISSING}/x", "https://${MISSING}/x"},
+		{"https://${jira}/x", "https://${jira}/x"},
+		{"https://$JIRA/x", "https://$JIRA/x"},
+		{"https://example.com", "https://example.com"},
+	} {
+		if got := expandVariables(test.url, vars); got != test.want {
+			t.Errorf("expandVariables(%q) = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+func TestIsTrusted(t *testing.T) {
+	trusted := parseTrustedDomains("example.com, .corp.net\nGitHub.com")
+	for _, test := range []struct {
+		url     string
+		trusted []string
+		want    bool
+	}{
+		{"https://example.com/a", trusted, true},
+		{"https://wiki.example.com", trusted, true},
+		{"https://EXAMPLE.com", trusted, true},
+		{"https://intranet.corp.net", trusted, true},
+		{"https://github.com", trusted, true},
+		{"https://example.com.evil.net", trusted, false},
+		{"https://notexample.com", trusted, false},
+		{"https://evil.net/?u=https://example.com", trusted, false},
+		{"https://example.com@evil.net", trusted, false},
+		{"javascript:alert(1)", trusted, false},
+		{"https://anything.net", nil, true},
+		{"ftp://example.com", nil, false},
+		{"javascript:alert(1)", nil, false},
+	} {
+		if got := isTrusted(test.url, test.trusted); got != test.want {
+			t.Errorf("isTrusted(%q, %v) = %v, want %v", test.url, test.trusted, got, test.want)
+		}
+	}
+}
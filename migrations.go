@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migration upgrades the schema by one version. Migrations run in order, each in its own
+// transaction, and are never edited once released: changes to the schema go in a new one.
+//
+// Databases created before schema_version existed went through some of these steps
+// already, so migrations create tables and columns only when they are missing.
+type migration struct {
+	description string
+	up          func(s *sqlStore, tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{"create links, history and settings", func(s *sqlStore, tx *sql.Tx) error {
+		return s.execAll(tx,
+			`CREATE TABLE IF NOT EXISTS items (
+				id `+s.dialect.autoIncrement+`,
+				name TEXT NOT NULL UNIQUE,
+				url TEXT NOT NULL,
+				singleword INTEGER DEFAULT 0,
+				count INTEGER DEFAULT 0
+			)`,
+			`CREATE TABLE IF NOT EXISTS queries (
+				id `+s.dialect.autoIncrement+`,
+				keyword TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT `+s.dialect.currentTimestamp+`
+			)`,
+			`CREATE TABLE IF NOT EXISTS settings (
+				id `+s.dialect.autoIncrement+`,
+				setting TEXT NOT NULL UNIQUE,
+				value TEXT NOT NULL
+			)`,
+			"INSERT INTO settings (setting, value) VALUES ('fallback_url', 'https://www.duckduckgo.com/?q={searchTerms}') ON CONFLICT DO NOTHING",
+			"INSERT INTO settings (setting, value) VALUES ('keyword_add', '!add') ON CONFLICT DO NOTHING",
+			"INSERT INTO settings (setting, value) VALUES ('keyword_mod', '!mod') ON CONFLICT DO NOTHING",
+			"INSERT INTO settings (setting, value) VALUES ('keyword_del', '!del') ON CONFLICT DO NOTHING",
+		)
+	}},
+	{"add argument constraints to links", func(s *sqlStore, tx *sql.Tx) error {
+		return s.addColumns(tx, "items",
+			"arg_type TEXT NOT NULL DEFAULT ''",
+			"arg_regex TEXT NOT NULL DEFAULT ''",
+			"arg_alternate TEXT NOT NULL DEFAULT ''",
+		)
+	}},
+	{"keep renamed keywords as aliases", func(s *sqlStore, tx *sql.Tx) error {
+		return s.execAll(tx,
+			`CREATE TABLE IF NOT EXISTS aliases (
+				id `+s.dialect.autoIncrement+`,
+				name TEXT NOT NULL UNIQUE,
+				target TEXT NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				count INTEGER DEFAULT 0
+			)`,
+		)
+	}},
+	{"add owner and last update to links, trusted domains", func(s *sqlStore, tx *sql.Tx) error {
+		err := s.addColumns(tx, "items",
+			"owner TEXT NOT NULL DEFAULT ''",
+			"updated_at TIMESTAMP",
+		)
+		if err != nil {
+			return err
+		}
+		return s.execAll(tx,
+			"INSERT INTO settings (setting, value) VALUES ('trusted_domains', '') ON CONFLICT DO NOTHING",
+		)
+	}},
+	{"add the URL shortener", func(s *sqlStore, tx *sql.Tx) error {
+		err := s.addColumns(tx, "items",
+			"generated INTEGER NOT NULL DEFAULT 0",
+		)
+		if err != nil {
+			return err
+		}
+		return s.execAll(tx,
+			"INSERT INTO settings (setting, value) VALUES ('keyword_short', '!short') ON CONFLICT DO NOTHING",
+			"INSERT INTO settings (setting, value) VALUES ('short_alphabet', '23456789abcdefghjkmnpqrstuvwxyz') ON CONFLICT DO NOTHING",
+			"INSERT INTO settings (setting, value) VALUES ('short_length', '5') ON CONFLICT DO NOTHING",
+		)
+	}},
+	{"add scheduled backups", func(s *sqlStore, tx *sql.Tx) error {
+		return s.execAll(tx,
+			"INSERT INTO settings (setting, value) VALUES ('backup_schedule', 'off') ON CONFLICT DO NOTHING",
+			"INSERT INTO settings (setting, value) VALUES ('backup_keep_daily', '7') ON CONFLICT DO NOTHING",
+			"INSERT INTO settings (setting, value) VALUES ('backup_keep_weekly', '4') ON CONFLICT DO NOTHING",
+		)
+	}},
+	{"move deleted links to the trash", func(s *sqlStore, tx *sql.Tx) error {
+		return s.execAll(tx,
+			`CREATE TABLE IF NOT EXISTS trash (
+				id `+s.dialect.autoIncrement+`,
+				name TEXT NOT NULL,
+				url TEXT NOT NULL,
+				singleword INTEGER DEFAULT 0,
+				count INTEGER DEFAULT 0,
+				arg_type TEXT NOT NULL DEFAULT '',
+				arg_regex TEXT NOT NULL DEFAULT '',
+				arg_alternate TEXT NOT NULL DEFAULT '',
+				owner TEXT NOT NULL DEFAULT '',
+				updated_at TIMESTAMP,
+				generated INTEGER NOT NULL DEFAULT 0,
+				deleted_by TEXT NOT NULL DEFAULT '',
+				deleted_at TIMESTAMP NOT NULL
+			)`,
+			"INSERT INTO settings (setting, value) VALUES ('trash_days', '30') ON CONFLICT DO NOTHING",
+		)
+	}},
+	{"keep the revisions of links", func(s *sqlStore, tx *sql.Tx) error {
+		err := s.addColumns(tx, "trash",
+			"link_id INTEGER NOT NULL DEFAULT 0",
+		)
+		if err != nil {
+			return err
+		}
+		return s.execAll(tx,
+			`CREATE TABLE IF NOT EXISTS revisions (
+				id `+s.dialect.autoIncrement+`,
+				link_id INTEGER NOT NULL,
+				action TEXT NOT NULL,
+				before_state TEXT,
+				after_state TEXT,
+				actor TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL
+			)`,
+			"CREATE INDEX IF NOT EXISTS revisions_link_id ON revisions (link_id)",
+		)
+	}},
+	{"add the audit log", func(s *sqlStore, tx *sql.Tx) error {
+		err := s.execAll(tx,
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id `+s.dialect.autoIncrement+`,
+				created_at TIMESTAMP NOT NULL,
+				actor TEXT NOT NULL DEFAULT '',
+				ip TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				target TEXT NOT NULL DEFAULT '',
+				before_value TEXT NOT NULL DEFAULT '',
+				after_value TEXT NOT NULL DEFAULT ''
+			)`,
+			"CREATE INDEX IF NOT EXISTS audit_log_created_at ON audit_log (created_at)",
+		)
+		if err != nil {
+			return err
+		}
+		return s.execAll(tx, s.dialect.appendOnly("audit_log")...)
+	}},
+	{"record when links were created", func(s *sqlStore, tx *sql.Tx) error {
+		for _, table := range []string{"items", "trash"} {
+			if err := s.addColumns(tx, table, "created_at TIMESTAMP"); err != nil {
+				return err
+			}
+		}
+		// The last update is the best guess for existing links, short links are never edited
+		return s.execAll(tx,
+			"UPDATE items SET created_at = updated_at WHERE created_at IS NULL",
+			"UPDATE trash SET created_at = updated_at WHERE created_at IS NULL",
+		)
+	}},
+}
+
+// schemaVersion is the version of the schema this binary works with.
+var schemaVersion = len(migrations)
+
+// migrate applies the migrations the database hasn't seen yet. It refuses to touch a
+// database written by a newer GoMarks, which may rely on columns this binary would mishandle.
+func (s *sqlStore) migrate() error {
+	_, err := s.exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT ` + s.dialect.currentTimestamp + `
+	)`)
+	if err != nil {
+		return err
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current > schemaVersion {
+		return fmt.Errorf("database schema version %d is newer than the %d supported by this binary, please upgrade GoMarks", current, schemaVersion)
+	}
+	if current == schemaVersion {
+		log.Printf("Database exists (schema version %d)", current)
+		return nil
+	}
+
+	for version := current + 1; version <= schemaVersion; version++ {
+		m := migrations[version-1]
+		log.Printf("Migrating database to schema version %d: %s", version, m.description)
+		if err := s.applyMigration(version, m); err != nil {
+			return fmt.Errorf("migration to schema version %d failed: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) applyMigration(version int, m migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(s, tx); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(s.rebind("INSERT INTO schema_version (version, description) VALUES (?, ?)"), version, m.description)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SchemaVersion returns the version of the schema stored in the database, 0 for a new one.
+func (s *sqlStore) SchemaVersion() (int, error) {
+	var version int
+	err := s.queryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// execAll runs statements without placeholders in a transaction.
+func (s *sqlStore) execAll(tx *sql.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumns adds columns to a table, skipping the ones it already has. Each column is
+// given as its definition, starting with its name.
+func (s *sqlStore) addColumns(tx *sql.Tx, table string, columns ...string) error {
+	existing := make(map[string]bool)
+	rows, err := tx.Query(s.rebind(s.dialect.columnsQuery), table)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, definition := range columns {
+		var name string
+		fmt.Sscan(definition, &name)
+		if existing[name] {
+			continue
+		}
+		if _, err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyEntry is a revision as shown on the edit page.
+type historyEntry struct {
+	ID      int
+	Action  string
+	Actor   string
+	When    string
+	Age     string
+	Changes []fieldChange
+	// Revertable when the revision left the link in a state other than the current one
+	Revertable bool
+}
+
+// fieldChange is a field of a link changed by a revision.
+type fieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// diffVersions lists the fields that differ between two versions of a link, nil standing
+// for a link that doesn't exist.
+func diffVersions(before *LinkVersion, after *LinkVersion) []fieldChange {
+	fields := func(v *LinkVersion) []string {
+		if v == nil {
+			v = &LinkVersion{}
+		}
+		singleword := "no"
+		if v.Singleword == 1 {
+			singleword = "yes"
+		}
+		return []string{v.Name, v.URL, singleword, v.ArgType, v.ArgRegex, v.ArgAlternate}
+	}
+	names := []string{"Keyword", "URL", "Single option", "Option constraint", "Regex", "Alternate keyword"}
+
+	var changes []fieldChange
+	previous, next := fields(before), fields(after)
+	for i := range names {
+		if previous[i] != next[i] {
+			changes = append(changes, fieldChange{names[i], previous[i], next[i]})
+		}
+	}
+	return changes
+}
+
+// linkHistory returns the revisions of a link, newest first, for the edit page.
+func (s *server) linkHistory(link Link) ([]historyEntry, error) {
+	revisions, err := s.store.LinkRevisions(link.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := versionOf(link)
+	var history []historyEntry
+	for _, revision := range revisions {
+		history = append(history, historyEntry{
+			ID:         revision.ID,
+			Action:     revision.Action,
+			Actor:      revision.Actor,
+			When:       revision.CreatedAt.Format(time.RFC3339),
+			Age:        formatAge(time.Since(revision.CreatedAt)),
+			Changes:    diffVersions(revision.Before, revision.After),
+			Revertable: revision.After != nil && *revision.After != *current,
+		})
+	}
+	return history, nil
+}
+
+// handleRevert puts a link back in the state a revision left it in. The revert is a
+// revision of its own, so it can be reverted too.
+func (s *server) handleRevert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Path[len("/revert/"):])
+	if err != nil {
+		http.Error(w, "Revision not found.", http.StatusNotFound)
+		return
+	}
+
+	revision, err := s.store.GetRevision(id)
+	if err != nil {
+		http.Error(w, "Revision not found.", http.StatusNotFound)
+		return
+	}
+	if revision.After == nil {
+		http.Error(w, "The link was deleted by this revision, restore it from the trash instead.", http.StatusBadRequest)
+		return
+	}
+
+	links, err := s.store.ListLinks()
+	if err != nil {
+		http.Error(w, "Failed to fetch links.", http.StatusInternalServerError)
+		return
+	}
+	var current *Link
+	for i := range links {
+		if links[i].ID == revision.LinkID {
+			current = &links[i]
+		}
+	}
+	if current == nil {
+		http.Error(w, "The link doesn't exist anymore, restore it from the trash first.", http.StatusNotFound)
+		return
+	}
+
+	// Going back to an older keyword only works while nothing else uses it
+	version := revision.After
+	if !strings.EqualFold(version.Name, current.Name) {
+		taken, err := s.revertTaken(version.Name, current.Name)
+		if err != nil {
+			http.Error(w, "Failed to check the keyword.", http.StatusInternalServerError)
+			return
+		}
+		if taken {
+			http.Error(w, "Keyword "+version.Name+" is used by something else now, it can't be reverted to.", http.StatusConflict)
+			return
+		}
+	}
+
+	link := Link{
+		Name:         version.Name,
+		URL:          version.URL,
+		Singleword:   version.Singleword,
+		ArgType:      version.ArgType,
+		ArgRegex:     version.ArgRegex,
+		ArgAlternate: version.ArgAlternate,
+		UpdatedAt:    time.Now(),
+	}
+
+	// An old version may break rules added since, or use a keyword reserved since
+	reserved, err := s.reservedKeywords()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	vars, err := s.store.Variables()
+	if err != nil {
+		http.Error(w, "Failed to fetch variables.", http.StatusInternalServerError)
+		return
+	}
+	if err := validateLink(link, reserved, vars); err != nil {
+		http.Error(w, "This version can't be reverted to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.UpdateLink(current.Name, link, time.Time{}, getActor(r))
+	if err != nil {
+		http.Error(w, "Failed to revert the link.", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "link.revert", current.Name, linkJSON(*current), linkJSON(link))
+
+	http.Redirect(w, r, "/?modified="+version.Name, http.StatusSeeOther)
+}
+
+// revertTaken reports whether a link can't go back to keyword. The alias left by renaming
+// the link itself doesn't count, UpdateLink drops it when the link takes its name back.
+func (s *server) revertTaken(keyword string, current string) (bool, error) {
+	alias, err := s.store.GetAlias(keyword, time.Now())
+	if err != nil && err != ErrNotFound {
+		return false, err
+	}
+	if err == ErrNotFound || !strings.EqualFold(alias.Target, current) {
+		return s.store.KeywordTaken(keyword)
+	}
+
+	if _, err := s.store.GetLink(keyword); err != ErrNotFound {
+		return err == nil, err
+	}
+	reserved, err := s.reservedKeywords()
+	if err != nil {
+		return false, err
+	}
+	return isReserved(keyword, reserved), nil
+}
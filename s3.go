@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Target stores offsite copies of the backups in a bucket of an S3-compatible object
+// storage (AWS S3, MinIO, Garage, Ceph...). Requests are signed with AWS Signature
+// Version 4 and use path-style URLs, which every implementation supports.
+type s3Target struct {
+	endpoint  *neturl.URL
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// s3Object is an object of a bucket listing.
+type s3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// newS3Target returns the target described by the config, nil when no bucket is set.
+// Credentials come from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+func newS3Target(cfg config) (*s3Target, error) {
+	if cfg.S3Bucket == "" {
+		return nil, nil
+	}
+
+	endpoint, err := neturl.Parse(cfg.S3Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q, expected a URL like https://s3.amazonaws.com", cfg.S3Endpoint)
+	}
+
+	t := &s3Target{
+		endpoint:  endpoint,
+		bucket:    cfg.S3Bucket,
+		prefix:    cfg.S3Prefix,
+		region:    cfg.S3Region,
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+	if t.accessKey == "" || t.secretKey == "" {
+		return nil, fmt.Errorf("S3 bucket %q is set but AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY is missing", t.bucket)
+	}
+	return t, nil
+}
+
+// String returns the location of the backups, for messages.
+func (t *s3Target) String() string {
+	return "s3://" + path.Join(t.bucket, t.prefix)
+}
+
+// Upload puts a local file in the bucket, under the prefix.
+func (t *s3Target) Upload(file string, name string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The payload is signed, so it is read twice: once for its hash, once to send it
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := t.request(http.MethodPut, t.prefix+name, nil, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	_, err = t.do(req, hex.EncodeToString(hash.Sum(nil)))
+	return err
+}
+
+// List returns the objects under the prefix, with the prefix removed from their key.
+func (t *s3Target) List() ([]s3Object, error) {
+	var objects []s3Object
+	token := ""
+	for {
+		query := neturl.Values{"list-type": {"2"}, "prefix": {t.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := t.request(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := t.do(req, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			objects = append(objects, s3Object{strings.TrimPrefix(object.Key, t.prefix), object.Size, object.LastModified})
+		}
+
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Delete removes an object, named without the prefix.
+func (t *s3Target) Delete(name string) error {
+	req, err := t.request(http.MethodDelete, t.prefix+name, nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = t.do(req, emptyPayloadHash)
+	return err
+}
+
+// request builds a path-style request on a key of the bucket, the bucket itself when key is empty.
+func (t *s3Target) request(method string, key string, query neturl.Values, body io.Reader) (*http.Request, error) {
+	u := *t.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + t.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = canonicalQuery(query)
+	return http.NewRequest(method, u.String(), body)
+}
+
+// Hex SHA-256 of an empty payload
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// do signs and sends a request, and returns the response body of a successful one.
+func (t *s3Target) do(req *http.Request, payloadHash string) ([]byte, error) {
+	t.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var s3Error struct {
+			Code    string
+			Message string
+		}
+		xml.Unmarshal(body, &s3Error)
+		return nil, fmt.Errorf("S3 %s %s: %s %s %s", req.Method, req.URL.Path, resp.Status, s3Error.Code, s3Error.Message)
+	}
+	return body, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to a request.
+func (t *s3Target) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + t.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+t.secretKey), date)
+	key = hmacSHA256(key, t.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", t.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes a query string the way Signature Version 4 expects it: sorted
+// by key, with spaces as %20 rather than +.
+func canonicalQuery(query neturl.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3Escape(s string) string {
+	return strings.ReplaceAll(neturl.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,148 @@
+//go:build s3
+
+package main
+
+// These tests run the S3 client against a bucket, MinIO in the CI:
+//
+//	AWS_ACCESS_KEY_ID=... AWS_SECRET_ACCESS_KEY=... GOMARKS_S3_ENDPOINT=http://localhost:9000 \
+//	GOMARKS_S3_BUCKET=backups go test -tags s3 ./...
+//
+// Objects are written under a prefix of their own, deleted when the test ends.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestS3Target(t *testing.T) *s3Target {
+	t.Helper()
+	cfg := config{
+		S3Endpoint: os.Getenv("GOMARKS_S3_ENDPOINT"),
+		S3Bucket:   os.Getenv("GOMARKS_S3_BUCKET"),
+		S3Region:   "us-east-1",
+		S3Prefix:   fmt.Sprintf("gomarks-test-%d/", time.Now().UnixNano()),
+	}
+	if cfg.S3Bucket == "" {
+		t.Skip("GOMARKS_S3_BUCKET is not set")
+	}
+	target, err := newS3Target(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		objects, _ := target.List()
+		for _, object := range objects {
+			target.Delete(object.Key)
+		}
+	})
+	return target
+}
+
+func TestS3UploadListDelete(t *testing.T) {
+	target := newTestS3Target(t)
+
+	file := filepath.Join(t.TempDir(), "items.db")
+	if err := os.WriteFile(file, []byte("SQLite format 3\x00 not really"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"items.db.20240101_120000", "items.db.20240102_120000"}
+	for _, name := range names {
+		if err := target.Upload(file, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects, err := target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != len(names) {
+		t.Fatalf("listed %v, want %v", objects, names)
+	}
+	for i, object := range objects {
+		// Keys come back without the prefix, in lexical order
+		if object.Key != names[i] || object.Size != 24 {
+			t.Errorf("object %d = %+v, want %s of 24 bytes", i, object, names[i])
+		}
+	}
+
+	if err := target.Delete(names[0]); err != nil {
+		t.Fatal(err)
+	}
+	objects, err = target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != names[1] {
+		t.Errorf("listed %v after deleting %s, want only %s", objects, names[0], names[1])
+	}
+}
+
+func TestS3ListPages(t *testing.T) {
+	target := newTestS3Target(t)
+
+	// Listings come by pages of 1000 objects
+	file := filepath.Join(t.TempDir(), "items.db")
+	if err := os.WriteFile(file, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 1001; i++ {
+		name := "items.db." + start.Add(time.Duration(i)*time.Second).Format(backupTimestampLayout)
+		if err := target.Upload(file, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects, err := target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1001 {
+		t.Errorf("listed %d objects, want 1001", len(objects))
+	}
+}
+
+func TestS3PruneOffsiteBackups(t *testing.T) {
+	target := newTestS3Target(t)
+	s := &server{dbPath: "/data/items.db", s3: target}
+
+	file := filepath.Join(t.TempDir(), "items.db")
+	if err := os.WriteFile(file, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Three days with two backups each, plus an object of another tool
+	for _, name := range []string{"items.db.20240101_080000", "items.db.20240101_200000", "items.db.20240102_080000", "items.db.20240102_200000", "items.db.20240103_080000", "items.db.20240103_200000", "notes.txt"} {
+		if err := target.Upload(file, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := s.listOffsiteBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := pruneWith(backups, 2, 0, target.Delete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 4 {
+		t.Errorf("pruned %d backups, want 4", pruned)
+	}
+
+	objects, err := target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, object := range objects {
+		kept = append(kept, object.Key)
+	}
+	want := []string{"items.db.20240102_200000", "items.db.20240103_200000", "notes.txt"}
+	if fmt.Sprint(kept) != fmt.Sprint(want) {
+		t.Errorf("kept %v, want %v", kept, want)
+	}
+}
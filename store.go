@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by a Store when the requested link, alias or setting doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrUnsupported is returned by a Store for operations its database can't do.
+var ErrUnsupported = errors.New("not supported by this database")
+
+// ErrTaken is returned by a Store when a link is added under the name of another link.
+var ErrTaken = errors.New("name already taken")
+
+// Link is a shortcut: a keyword and the URL it redirects to.
+type Link struct {
+	ID           int
+	Name         string
+	URL          string
+	Singleword   int
+	Count        int
+	ArgType      string
+	ArgRegex     string
+	ArgAlternate string
+	Owner        string
+	UpdatedAt    time.Time // zero for links created before it was tracked
+	Generated    int       // 1 for links created by the URL shortener
+	CreatedAt    time.Time // set by the Store when the link is added, zero for links older than that
+}
+
+// TrashedLink is a deleted link waiting in the trash. Its Link.ID is its ID in the trash,
+// LinkID the ID it had as a link.
+type TrashedLink struct {
+	Link
+	LinkID    int
+	DeletedBy string
+	DeletedAt time.Time
+}
+
+// LinkVersion is what a revision keeps of a link: everything a user edits.
+type LinkVersion struct {
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	Singleword   int    `json:"singleword"`
+	ArgType      string `json:"arg_type"`
+	ArgRegex     string `json:"arg_regex"`
+	ArgAlternate string `json:"arg_alternate"`
+}
+
+func versionOf(link Link) *LinkVersion {
+	return &LinkVersion{link.Name, link.URL, link.Singleword, link.ArgType, link.ArgRegex, link.ArgAlternate}
+}
+
+// Revision is a change of a link. Before is nil when the link was created, After when
+// it was deleted.
+type Revision struct {
+	ID        int
+	LinkID    int
+	Action    string // create, import, update, delete or restore
+	Before    *LinkVersion
+	After     *LinkVersion
+	Actor     string
+	CreatedAt time.Time
+}
+
+// ImportPlan is what an import changes, applied all at once or not at all.
+type ImportPlan struct {
+	Add       []Link
+	Replace   []Link            // replace the links of the same name, counter included
+	AddCounts map[string]int    // visits added to the counter of links, by name
+	Settings  map[string]string // only settings that exist already are changed
+	Variables map[string]string // added or replaced
+}
+
+// AuditEntry is a state-changing action, as recorded in the audit log.
+type AuditEntry struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Actor     string    `json:"actor"`
+	IP        string    `json:"ip"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Before    string    `json:"before"`
+	After     string    `json:"after"`
+}
+
+// AuditFilter selects audit log entries, empty fields match everything.
+type AuditFilter struct {
+	Actor  string
+	Action string // prefix, like "link." for every change of links
+	Search string // part of the target, before or after values
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// Query is an entry of the queries history.
+type Query struct {
+	Keyword   string
+	CreatedAt time.Time
+}
+
+// Visits is a batch of what redirects record: the queries and the visits of links and
+// aliases, by name.
+type Visits struct {
+	Queries     []Query
+	Counts      map[string]int
+	AliasCounts map[string]int
+}
+
+// Alias is the old name of a renamed link, answering until it expires.
+type Alias struct {
+	Name      string
+	Target    string
+	ExpiresAt time.Time
+	Count     int
+}
+
+// Store holds everything GoMarks persists. Handlers only talk to the database through it.
+//
+// Link names are matched case-insensitively unless stated otherwise.
+type Store interface {
+	// Links
+	ListLinks() ([]Link, error)
+	GetLink(name string) (Link, error)
+	// AddLink creates a link, its owner is the author of its first revision. It returns
+	// ErrTaken when another link has the same name.
+	AddLink(link Link) error
+	// UpdateLink replaces the link named name. When the link is renamed and aliasUntil
+	// isn't zero, the old name stays as an alias until then.
+	UpdateLink(name string, link Link, aliasUntil time.Time, actor string) error
+	// DeleteLink moves a link to the trash, its keyword is free again right away. It
+	// returns ErrNotFound when no link has the name.
+	DeleteLink(name string, actor string) error
+	CountLinksContaining(text string) (int, error)
+	// PruneShortLinks deletes generated links created before a date and returns how many went.
+	// Links without a creation time are kept.
+	PruneShortLinks(before time.Time, unusedOnly bool) (int64, error)
+	// ApplyImport applies an import plan in one transaction, actor being who imports.
+	ApplyImport(plan ImportPlan, actor string) error
+	// KeywordTaken reports whether a keyword is used by a link, an alias or a reserved keyword.
+	KeywordTaken(keyword string) (bool, error)
+
+	// Trash of deleted links, newest first
+	ListTrash() ([]TrashedLink, error)
+	// RestoreLink puts a trashed link back, with its counter and history, and returns it.
+	RestoreLink(id int, actor string) (Link, error)
+	// DeleteTrashed deletes a trashed link for good, ErrNotFound when it isn't in the trash.
+	DeleteTrashed(id int) error
+	// PurgeTrash deletes the links trashed before a date for good and returns how many went.
+	PurgeTrash(before time.Time) (int64, error)
+
+	// Revisions recorded by the link writes above, newest first
+	LinkRevisions(linkID int) ([]Revision, error)
+	GetRevision(id int) (Revision, error)
+
+	// Stats. Resets return ErrNotFound for an unknown link, or how many counters they reset.
+	IncrementCount(name string) error
+	ResetCount(name string) error
+	ResetAllCounts() (int64, error)
+
+	// Aliases of renamed links, expired aliases are never returned
+	ListAliases(now time.Time) ([]Alias, error)
+	GetAlias(name string, now time.Time) (Alias, error)
+	IncrementAliasCount(name string) error
+	// DeleteAlias returns ErrNotFound when no alias has the name.
+	DeleteAlias(name string) error
+	PurgeAliases(now time.Time) error
+
+	// Settings
+	Settings() (map[string]string, error)
+	GetSetting(setting string) (string, error)
+	SetSetting(setting string, value string) error
+	Variables() (map[string]string, error)
+	AddVariable(name string, value string) error
+	// UpdateVariable also renames ${oldName} in the links and the fallback URL using it,
+	// in the same transaction. Both return ErrNotFound for an unknown variable.
+	UpdateVariable(oldName string, name string, value string) error
+	DeleteVariable(name string) error
+
+	// History
+	LogQuery(keyword string) error
+	// RecordVisits writes a batch of queries and visit counts in one transaction.
+	RecordVisits(visits Visits) error
+	RecentQueries(limit int) ([]Query, error)
+	// ClearQueries deletes the history and returns how many queries it held.
+	ClearQueries() (int64, error)
+
+	// Audit log, append-only: entries are never changed nor deleted
+	AddAuditEntry(entry AuditEntry) error
+	// AuditLog returns the matching entries, newest first.
+	AuditLog(filter AuditFilter) ([]AuditEntry, error)
+
+	// Backup writes a consistent copy of the database to a new file and checks its integrity.
+	Backup(path string) error
+	// Restore replaces the content of the database with a backup file, then brings its
+	// schema up to date. The caller checks the backup beforehand.
+	Restore(path string) error
+
+	Close() error
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedStore keeps links, aliases and settings in memory so resolving a query doesn't
+// need the database. Writes go to the wrapped Store and drop the snapshot, the next read
+// loads a fresh one. Visit counts are the exception: they are bumped in place, otherwise
+// every redirect would throw the snapshot away.
+//
+// Every method writing links, aliases or settings must be wrapped here, the embedded
+// Store only serves the rest. PurgeAliases is left out on purpose: it only deletes
+// expired aliases, which reads skip anyway, and the schedule calls it every minute.
+// The trash isn't cached, only restoring from it touches the links.
+type cachedStore struct {
+	Store
+
+	mu         sync.RWMutex
+	snap       *snapshot
+	generation int // bumped by every write, so a load racing with a write is discarded
+}
+
+type snapshot struct {
+	links    []Link         // sorted by name, like ListLinks
+	byName   map[string]int // lowercase name to index in links
+	aliases  []Alias
+	settings map[string]string
+	vars     map[string]string
+}
+
+func newCachedStore(store Store) *cachedStore {
+	return &cachedStore{Store: store}
+}
+
+// snapshot returns the current snapshot, loading it when needed. The caller holds the read lock.
+func (c *cachedStore) snapshot() (*snapshot, error) {
+	if c.snap != nil {
+		return c.snap, nil
+	}
+
+	// Loading takes the write lock, the read lock is given back meanwhile
+	generation := c.generation
+	c.mu.RUnlock()
+	snap, err := c.load()
+	c.mu.Lock()
+	if err == nil && c.generation == generation {
+		c.snap = snap
+	}
+	c.mu.Unlock()
+	c.mu.RLock()
+	return snap, err
+}
+
+func (c *cachedStore) load() (*snapshot, error) {
+	links, err := c.Store.ListLinks()
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := c.Store.ListAliases(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	settings, err := c.Store.Settings()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{
+		links:    links,
+		byName:   make(map[string]int, len(links)),
+		aliases:  aliases,
+		settings: settings,
+		vars:     make(map[string]string),
+	}
+	for i, link := range links {
+		snap.byName[strings.ToLower(link.Name)] = i
+	}
+	for setting, value := range settings {
+		if name, ok := strings.CutPrefix(setting, variablePrefix); ok {
+			snap.vars[name] = value
+		}
+	}
+	return snap, nil
+}
+
+// invalidate drops the snapshot after a write.
+func (c *cachedStore) invalidate() {
+	c.mu.Lock()
+	c.snap = nil
+	c.generation++
+	c.mu.Unlock()
+}
+
+// Reads
+
+func (c *cachedStore) ListLinks() ([]Link, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snap, err := c.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return append([]Link(nil), snap.links...), nil
+}
+
+func (c *cachedStore) GetLink(name string) (Link, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snap, err := c.snapshot()
+	if err != nil {
+		return Link{}, err
+	}
+	i, ok := snap.byName[strings.ToLower(name)]
+	if !ok {
+		return Link{}, ErrNotFound
+	}
+	return snap.links[i], nil
+}
+
+func (c *cachedStore) ListAliases(now time.Time) ([]Alias, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snap, err := c.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	var aliases []Alias
+	for _, alias := range snap.aliases {
+		if alias.ExpiresAt.After(now) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases, nil
+}
+
+func (c *cachedStore) GetAlias(name string, now time.Time) (Alias, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snap, err := c.snapshot()
+	if err != nil {
+		return Alias{}, err
+	}
+	for _, alias := range snap.aliases {
+		if strings.EqualFold(alias.Name, name) && alias.ExpiresAt.After(now) {
+			return alias, nil
+		}
+	}
+	return Alias{}, ErrNotFound
+}
+
+func (c *cachedStore) Settings() (map[string]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snap, err := c.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]string, len(snap.settings))
+	for setting, value := range snap.settings {
+		settings[setting] = value
+	}
+	return settings, nil
+}
+
+func (c *cachedStore) GetSetting(setting string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snap, err := c.snapshot()
+	if err != nil {
+		return "", err
+	}
+	value, ok := snap.settings[setting]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (c *cachedStore) Variables() (map[string]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snap, err := c.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, len(snap.vars))
+	for name, value := range snap.vars {
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// Counters, updated in place
+
+func (c *cachedStore) IncrementCount(name string) error {
+	if err := c.Store.IncrementCount(name); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.snap != nil {
+		// Like the database, only the exact name is counted
+		if i, ok := c.snap.byName[strings.ToLower(name)]; ok && c.snap.links[i].Name == name {
+			c.snap.links[i].Count++
+		}
+	}
+	return nil
+}
+
+func (c *cachedStore) IncrementAliasCount(name string) error {
+	if err := c.Store.IncrementAliasCount(name); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.snap != nil {
+		for i := range c.snap.aliases {
+			if strings.EqualFold(c.snap.aliases[i].Name, name) {
+				c.snap.aliases[i].Count++
+			}
+		}
+	}
+	return nil
+}
+
+// Writes
+
+func (c *cachedStore) AddLink(link Link) error {
+	defer c.invalidate()
+	return c.Store.AddLink(link)
+}
+
+func (c *cachedStore) UpdateLink(name string, link Link, aliasUntil time.Time, actor string) error {
+	defer c.invalidate()
+	return c.Store.UpdateLink(name, link, aliasUntil, actor)
+}
+
+func (c *cachedStore) DeleteLink(name string, actor string) error {
+	defer c.invalidate()
+	return c.Store.DeleteLink(name, actor)
+}
+
+func (c *cachedStore) ApplyImport(plan ImportPlan, actor string) error {
+	defer c.invalidate()
+	return c.Store.ApplyImport(plan, actor)
+}
+
+func (c *cachedStore) RestoreLink(id int, actor string) (Link, error) {
+	defer c.invalidate()
+	return c.Store.RestoreLink(id, actor)
+}
+
+func (c *cachedStore) PruneShortLinks(before time.Time, unusedOnly bool) (int64, error) {
+	defer c.invalidate()
+	return c.Store.PruneShortLinks(before, unusedOnly)
+}
+
+func (c *cachedStore) ResetCount(name string) error {
+	defer c.invalidate()
+	return c.Store.ResetCount(name)
+}
+
+func (c *cachedStore) ResetAllCounts() (int64, error) {
+	defer c.invalidate()
+	return c.Store.ResetAllCounts()
+}
+
+func (c *cachedStore) DeleteAlias(name string) error {
+	defer c.invalidate()
+	return c.Store.DeleteAlias(name)
+}
+
+func (c *cachedStore) SetSetting(setting string, value string) error {
+	defer c.invalidate()
+	return c.Store.SetSetting(setting, value)
+}
+
+func (c *cachedStore) AddVariable(name string, value string) error {
+	defer c.invalidate()
+	return c.Store.AddVariable(name, value)
+}
+
+func (c *cachedStore) UpdateVariable(oldName string, name string, value string) error {
+	defer c.invalidate()
+	return c.Store.UpdateVariable(oldName, name, value)
+}
+
+func (c *cachedStore) DeleteVariable(name string) error {
+	defer c.invalidate()
+	return c.Store.DeleteVariable(name)
+}
+
+func (c *cachedStore) Restore(path string) error {
+	defer c.invalidate()
+	return c.Store.Restore(path)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// newTestSQLiteStore opens a fresh SQLite store in a temporary directory.
+func newTestSQLiteStore(tb testing.TB) *sqlStore {
+	tb.Helper()
+	store, err := newSQLiteStore(filepath.Join(tb.TempDir(), "items.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { store.Close() })
+	return store
+}
+
+// benchmarkStore returns an SQLite store holding a thousand links.
+func benchmarkStore(b *testing.B) *sqlStore {
+	store := newTestSQLiteStore(b)
+	var plan ImportPlan
+	for i := 0; i < 1000; i++ {
+		plan.Add = append(plan.Add, Link{Name: fmt.Sprintf("link%d", i), URL: fmt.Sprintf("https://example.com/%d/%%s", i)})
+	}
+	if err := store.ApplyImport(plan, ""); err != nil {
+		b.Fatal(err)
+	}
+	return store
+}
+
+func BenchmarkGetLink(b *testing.B) {
+	store := benchmarkStore(b)
+	for _, bench := range []struct {
+		name  string
+		store Store
+	}{
+		{"sql", store},
+		{"cached", newCachedStore(store)},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				if _, err := bench.store.GetLink(fmt.Sprintf("LINK%d", i%1000)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListLinks(b *testing.B) {
+	store := benchmarkStore(b)
+	for _, bench := range []struct {
+		name  string
+		store Store
+	}{
+		{"sql", store},
+		{"cached", newCachedStore(store)},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := bench.store.ListLinks(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
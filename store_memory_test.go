@@ -0,0 +1,562 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store kept in maps, for tests of the handlers. It follows the SQL
+// store: names match case-insensitively, except where visits are counted.
+type memoryStore struct {
+	mu        sync.Mutex
+	links     map[string]Link  // by lowercase name
+	aliases   map[string]Alias // by lowercase name
+	settings  map[string]string
+	trash     []TrashedLink
+	revisions []Revision
+	queries   []Query
+	audit     []AuditEntry
+	lastID    int // of links, trashed links, revisions and audit entries alike
+}
+
+// newMemoryStore returns an empty store with the settings of a new database.
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		links:   make(map[string]Link),
+		aliases: make(map[string]Alias),
+		settings: map[string]string{
+			"fallback_url":       "https://www.duckduckgo.com/?q={searchTerms}",
+			"keyword_add":        "!add",
+			"keyword_mod":        "!mod",
+			"keyword_del":        "!del",
+			"keyword_short":      "!short",
+			"trusted_domains":    "",
+			"short_alphabet":     "23456789abcdefghjkmnpqrstuvwxyz",
+			"short_length":       "5",
+			"backup_schedule":    "off",
+			"backup_keep_daily":  "7",
+			"backup_keep_weekly": "4",
+			"trash_days":         "30",
+		},
+	}
+}
+
+func (m *memoryStore) nextID() int {
+	m.lastID++
+	return m.lastID
+}
+
+func (m *memoryStore) addRevision(linkID int, action string, before *LinkVersion, after *LinkVersion, actor string) {
+	m.revisions = append(m.revisions, Revision{ID: m.nextID(), LinkID: linkID, Action: action, Before: before, After: after, Actor: actor, CreatedAt: time.Now()})
+}
+
+// linkNamed returns the link with exactly this name, the way visits are counted.
+func (m *memoryStore) linkNamed(name string) (Link, bool) {
+	link, ok := m.links[strings.ToLower(name)]
+	return link, ok && link.Name == name
+}
+
+func (m *memoryStore) ListLinks() ([]Link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var links []Link
+	for _, link := range m.links {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+	return links, nil
+}
+
+func (m *memoryStore) GetLink(name string) (Link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.links[strings.ToLower(name)]
+	if !ok {
+		return Link{}, ErrNotFound
+	}
+	return link, nil
+}
+
+func (m *memoryStore) AddLink(link Link) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.insertLink(link, "create", link.Owner)
+}
+
+func (m *memoryStore) insertLink(link Link, action string, actor string) error {
+	if _, taken := m.links[strings.ToLower(link.Name)]; taken {
+		return ErrTaken
+	}
+	link.ID = m.nextID()
+	link.CreatedAt = time.Now()
+	m.links[strings.ToLower(link.Name)] = link
+	m.addRevision(link.ID, action, nil, versionOf(link), actor)
+	delete(m.aliases, strings.ToLower(link.Name))
+	return nil
+}
+
+func (m *memoryStore) UpdateLink(name string, link Link, aliasUntil time.Time, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	previous, ok := m.links[strings.ToLower(name)]
+	if !ok {
+		return ErrNotFound
+	}
+	name = previous.Name
+
+	updated := previous
+	updated.Name, updated.URL, updated.Singleword = link.Name, link.URL, link.Singleword
+	updated.ArgType, updated.ArgRegex, updated.ArgAlternate = link.ArgType, link.ArgRegex, link.ArgAlternate
+	updated.UpdatedAt = link.UpdatedAt
+	delete(m.links, strings.ToLower(name))
+	m.links[strings.ToLower(link.Name)] = updated
+
+	if before, after := versionOf(previous), versionOf(link); *before != *after {
+		m.addRevision(previous.ID, "update", before, after, actor)
+	}
+
+	if !strings.EqualFold(name, link.Name) {
+		delete(m.aliases, strings.ToLower(link.Name))
+		for key, alias := range m.aliases {
+			if strings.EqualFold(alias.Target, name) {
+				alias.Target = link.Name
+				m.aliases[key] = alias
+			}
+		}
+		if !aliasUntil.IsZero() {
+			m.aliases[strings.ToLower(name)] = Alias{Name: name, Target: link.Name, ExpiresAt: aliasUntil}
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) DeleteLink(name string, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.links[strings.ToLower(name)]
+	if !ok {
+		return ErrNotFound
+	}
+
+	trashed := TrashedLink{Link: link, LinkID: link.ID, DeletedBy: actor, DeletedAt: time.Now()}
+	trashed.ID = m.nextID()
+	m.trash = append(m.trash, trashed)
+	delete(m.links, strings.ToLower(name))
+	m.addRevision(link.ID, "delete", versionOf(link), nil, actor)
+
+	for key, alias := range m.aliases {
+		if strings.EqualFold(alias.Target, name) {
+			delete(m.aliases, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) CountLinksContaining(text string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, link := range m.links {
+		if strings.Contains(link.URL, text) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryStore) PruneShortLinks(before time.Time, unusedOnly bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pruned int64
+	for key, link := range m.links {
+		if link.Generated == 1 && !link.CreatedAt.IsZero() && !link.CreatedAt.After(before) && (!unusedOnly || link.Count == 0) {
+			delete(m.links, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+func (m *memoryStore) ApplyImport(plan ImportPlan, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// All or nothing: the checks run before anything changes
+	for _, link := range plan.Add {
+		if _, taken := m.links[strings.ToLower(link.Name)]; taken {
+			return ErrTaken
+		}
+	}
+	for _, link := range plan.Replace {
+		if _, ok := m.linkNamed(link.Name); !ok {
+			return ErrNotFound
+		}
+	}
+
+	for _, link := range plan.Add {
+		m.insertLink(link, "import", actor)
+	}
+	for _, link := range plan.Replace {
+		previous, _ := m.linkNamed(link.Name)
+		replaced := previous
+		replaced.URL, replaced.Singleword, replaced.Count = link.URL, link.Singleword, link.Count
+		replaced.ArgType, replaced.ArgRegex, replaced.ArgAlternate = link.ArgType, link.ArgRegex, link.ArgAlternate
+		replaced.UpdatedAt = link.UpdatedAt
+		m.links[strings.ToLower(link.Name)] = replaced
+		if before, after := versionOf(previous), versionOf(link); *before != *after {
+			m.addRevision(previous.ID, "import", before, after, actor)
+		}
+	}
+	for name, count := range plan.AddCounts {
+		if link, ok := m.linkNamed(name); ok {
+			link.Count += count
+			m.links[strings.ToLower(name)] = link
+		}
+	}
+	for setting, value := range plan.Settings {
+		if _, ok := m.settings[setting]; ok {
+			m.settings[setting] = value
+		}
+	}
+	for name, value := range plan.Variables {
+		m.settings[variablePrefix+name] = value
+	}
+	return nil
+}
+
+func (m *memoryStore) KeywordTaken(keyword string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, link := m.links[strings.ToLower(keyword)]
+	_, alias := m.aliases[strings.ToLower(keyword)]
+	if link || alias {
+		return true, nil
+	}
+	for setting, value := range m.settings {
+		if strings.HasPrefix(setting, "keyword_") && strings.EqualFold(value, keyword) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryStore) ListTrash() ([]TrashedLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	trash := append([]TrashedLink(nil), m.trash...)
+	sort.SliceStable(trash, func(i, j int) bool {
+		if !trash[i].DeletedAt.Equal(trash[j].DeletedAt) {
+			return trash[i].DeletedAt.After(trash[j].DeletedAt)
+		}
+		return trash[i].ID > trash[j].ID
+	})
+	return trash, nil
+}
+
+func (m *memoryStore) RestoreLink(id int, actor string) (Link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, trashed := range m.trash {
+		if trashed.ID != id {
+			continue
+		}
+		link := trashed.Link
+		if _, taken := m.links[strings.ToLower(link.Name)]; taken {
+			return Link{}, ErrTaken
+		}
+		link.ID = trashed.LinkID
+		m.links[strings.ToLower(link.Name)] = link
+		m.addRevision(link.ID, "restore", nil, versionOf(link), actor)
+		delete(m.aliases, strings.ToLower(link.Name))
+		m.trash = append(m.trash[:i], m.trash[i+1:]...)
+		return link, nil
+	}
+	return Link{}, ErrNotFound
+}
+
+func (m *memoryStore) DeleteTrashed(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, trashed := range m.trash {
+		if trashed.ID == id {
+			m.trash = append(m.trash[:i], m.trash[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *memoryStore) PurgeTrash(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []TrashedLink
+	for _, trashed := range m.trash {
+		if trashed.DeletedAt.After(before) {
+			kept = append(kept, trashed)
+		}
+	}
+	purged := int64(len(m.trash) - len(kept))
+	m.trash = kept
+	return purged, nil
+}
+
+func (m *memoryStore) LinkRevisions(linkID int) ([]Revision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var revisions []Revision
+	for i := len(m.revisions) - 1; i >= 0; i-- {
+		if m.revisions[i].LinkID == linkID {
+			revisions = append(revisions, m.revisions[i])
+		}
+	}
+	return revisions, nil
+}
+
+func (m *memoryStore) GetRevision(id int) (Revision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, revision := range m.revisions {
+		if revision.ID == id {
+			return revision, nil
+		}
+	}
+	return Revision{}, ErrNotFound
+}
+
+func (m *memoryStore) IncrementCount(name string) error {
+	return m.RecordVisits(Visits{Counts: map[string]int{name: 1}})
+}
+
+func (m *memoryStore) ResetCount(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.links[strings.ToLower(name)]
+	if !ok {
+		return ErrNotFound
+	}
+	link.Count = 0
+	m.links[strings.ToLower(name)] = link
+	return nil
+}
+
+func (m *memoryStore) ResetAllCounts() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var reset int64
+	for key, link := range m.links {
+		if link.Count != 0 {
+			link.Count = 0
+			m.links[key] = link
+			reset++
+		}
+	}
+	return reset, nil
+}
+
+func (m *memoryStore) ListAliases(now time.Time) ([]Alias, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var aliases []Alias
+	for _, alias := range m.aliases {
+		if alias.ExpiresAt.After(now) {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases, nil
+}
+
+func (m *memoryStore) GetAlias(name string, now time.Time) (Alias, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alias, ok := m.aliases[strings.ToLower(name)]
+	if !ok || !alias.ExpiresAt.After(now) {
+		return Alias{}, ErrNotFound
+	}
+	return alias, nil
+}
+
+func (m *memoryStore) IncrementAliasCount(name string) error {
+	return m.RecordVisits(Visits{AliasCounts: map[string]int{name: 1}})
+}
+
+func (m *memoryStore) DeleteAlias(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.aliases[strings.ToLower(name)]; !ok {
+		return ErrNotFound
+	}
+	delete(m.aliases, strings.ToLower(name))
+	return nil
+}
+
+func (m *memoryStore) PurgeAliases(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, alias := range m.aliases {
+		if !alias.ExpiresAt.After(now) {
+			delete(m.aliases, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) Settings() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	settings := make(map[string]string)
+	for setting, value := range m.settings {
+		settings[setting] = value
+	}
+	return settings, nil
+}
+
+func (m *memoryStore) GetSetting(setting string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.settings[setting]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *memoryStore) SetSetting(setting string, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.settings[setting]; ok {
+		m.settings[setting] = value
+	}
+	return nil
+}
+
+func (m *memoryStore) Variables() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	vars := make(map[string]string)
+	for setting, value := range m.settings {
+		if name, ok := strings.CutPrefix(setting, variablePrefix); ok {
+			vars[name] = value
+		}
+	}
+	return vars, nil
+}
+
+func (m *memoryStore) AddVariable(name string, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, taken := m.settings[variablePrefix+name]; taken {
+		return ErrTaken
+	}
+	m.settings[variablePrefix+name] = value
+	return nil
+}
+
+func (m *memoryStore) UpdateVariable(oldName string, name string, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.settings[variablePrefix+oldName]; !ok {
+		return ErrNotFound
+	}
+	delete(m.settings, variablePrefix+oldName)
+	m.settings[variablePrefix+name] = value
+
+	if oldName != name {
+		for key, link := range m.links {
+			link.URL = strings.ReplaceAll(link.URL, "${"+oldName+"}", "${"+name+"}")
+			m.links[key] = link
+		}
+		m.settings["fallback_url"] = strings.ReplaceAll(m.settings["fallback_url"], "${"+oldName+"}", "${"+name+"}")
+	}
+	return nil
+}
+
+func (m *memoryStore) DeleteVariable(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.settings[variablePrefix+name]; !ok {
+		return ErrNotFound
+	}
+	delete(m.settings, variablePrefix+name)
+	return nil
+}
+
+func (m *memoryStore) LogQuery(keyword string) error {
+	return m.RecordVisits(Visits{Queries: []Query{{Keyword: keyword, CreatedAt: time.Now()}}})
+}
+
+func (m *memoryStore) RecordVisits(visits Visits) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queries = append(m.queries, visits.Queries...)
+	for name, count := range visits.Counts {
+		if link, ok := m.linkNamed(name); ok {
+			link.Count += count
+			m.links[strings.ToLower(name)] = link
+		}
+	}
+	for name, count := range visits.AliasCounts {
+		if alias, ok := m.aliases[strings.ToLower(name)]; ok {
+			alias.Count += count
+			m.aliases[strings.ToLower(name)] = alias
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) RecentQueries(limit int) ([]Query, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	queries := append([]Query(nil), m.queries...)
+	sort.SliceStable(queries, func(i, j int) bool { return queries[i].CreatedAt.After(queries[j].CreatedAt) })
+	if len(queries) > limit {
+		queries = queries[:limit]
+	}
+	return queries, nil
+}
+
+func (m *memoryStore) ClearQueries() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cleared := int64(len(m.queries))
+	m.queries = nil
+	return cleared, nil
+}
+
+func (m *memoryStore) AddAuditEntry(entry AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.ID = m.nextID()
+	m.audit = append(m.audit, entry)
+	return nil
+}
+
+func (m *memoryStore) AuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []AuditEntry
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		entry := m.audit[i]
+		search := strings.ToLower(filter.Search)
+		switch {
+		case filter.Actor != "" && !strings.EqualFold(entry.Actor, filter.Actor),
+			!strings.HasPrefix(entry.Action, filter.Action),
+			search != "" && !strings.Contains(strings.ToLower(entry.Target+"\x00"+entry.Before+"\x00"+entry.After), search),
+			!filter.Since.IsZero() && entry.CreatedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !entry.CreatedAt.Before(filter.Until):
+			continue
+		}
+		entries = append(entries, entry)
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// Backups are SQLite files, a memory store has none
+func (m *memoryStore) Backup(path string) error  { return ErrUnsupported }
+func (m *memoryStore) Restore(path string) error { return ErrUnsupported }
+func (m *memoryStore) Close() error              { return nil }
@@ -0,0 +1,834 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Timestamps compared in SQL are stored in UTC with the same layout as CURRENT_TIMESTAMP
+const timestampLayout = "2006-01-02 15:04:05"
+
+// dialect holds what differs between the SQL databases GoMarks can run on.
+type dialect struct {
+	driver           string
+	autoIncrement    string // definition of the id column
+	currentTimestamp string // default value of the created_at column, in UTC
+	columnsQuery     string // lists the column names of a table
+	numbered         bool   // placeholders are $1, $2... instead of ?
+
+	// uniqueViolation reports whether an error comes from a UNIQUE constraint
+	uniqueViolation func(err error) bool
+
+	// appendOnly returns the statements creating triggers that reject updates and deletes on a table
+	appendOnly func(table string) []string
+}
+
+// sqlStore is the Store backed by a SQL database, SQLite or PostgreSQL.
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// openSQLStore connects to a database, creating and seeding it if needed.
+func openSQLStore(d dialect, dsn string) (*sqlStore, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqlStore{db: db, dialect: d}
+	if err := s.setup(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// rebind rewrites the ? placeholders of a query for the database in use. Question marks
+// in quoted string literals, like the URLs of the examples, are left alone.
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			// An escaped quote, doubled, closes and reopens the literal
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) exec(query string, args ...any) (sql.Result, error) {
+	return s.db.Exec(s.rebind(query), args...)
+}
+
+// changedRow turns the result of a statement meant to change a row into ErrNotFound when
+// no row matched.
+func changedRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) query(query string, args ...any) (*sql.Rows, error) {
+	return s.db.Query(s.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(query string, args ...any) *sql.Row {
+	return s.db.QueryRow(s.rebind(query), args...)
+}
+
+// setup brings the schema up to date and provides some examples on a new database.
+func (s *sqlStore) setup() error {
+	if err := s.migrate(); err != nil {
+		return err
+	}
+
+	// Check if the table already has data
+	var rowCountItems int
+	err := s.queryRow("SELECT COUNT(name) FROM items").Scan(&rowCountItems)
+	if err != nil {
+		return err
+	}
+
+	if rowCountItems == 0 {
+		log.Println("Importing some examples")
+		insertDataQuery := `
+		INSERT INTO items (name, url, singleword, count) VALUES ('amzn', 'https://www.amazon.com/s?k=%s', 0, 12);
+		INSERT INTO items (name, url, singleword, count) VALUES ('b', 'https://www.bbc.com', 0, 7);
+		INSERT INTO items (name, url, singleword, count) VALUES ('bbc', 'https://www.bbc.com/news/world/%s', 1, 3);
+		INSERT INTO items (name, url, singleword, count) VALUES ('docker', 'https://hub.docker.com/search?q=%s', 1, 33);
+		INSERT INTO items (name, url, singleword, count) VALUES ('verge', 'https://www.theverge.com/search?q=%s', 0, 69);
+		`
+		_, err = s.exec(insertDataQuery)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+const linkColumns = "id, name, url, singleword, count, arg_type, arg_regex, arg_alternate, owner, updated_at, generated, created_at"
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row scanner) (Link, error) {
+	var link Link
+	var updatedAt, createdAt sql.NullTime
+	err := row.Scan(&link.ID, &link.Name, &link.URL, &link.Singleword, &link.Count, &link.ArgType, &link.ArgRegex, &link.ArgAlternate, &link.Owner, &updatedAt, &link.Generated, &createdAt)
+	if updatedAt.Valid {
+		link.UpdatedAt = updatedAt.Time
+	}
+	if createdAt.Valid {
+		link.CreatedAt = createdAt.Time
+	}
+	return link, err
+}
+
+// nullTimestamp stores the zero time as NULL.
+func nullTimestamp(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(timestampLayout)
+}
+
+func (s *sqlStore) ListLinks() ([]Link, error) {
+	rows, err := s.query("SELECT " + linkColumns + " FROM items ORDER BY name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (s *sqlStore) GetLink(name string) (Link, error) {
+	link, err := scanLink(s.queryRow("SELECT "+linkColumns+" FROM items WHERE LOWER(name) = LOWER(?)", name))
+	if err == sql.ErrNoRows {
+		return link, ErrNotFound
+	}
+	return link, err
+}
+
+func (s *sqlStore) AddLink(link Link) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.insertLink(tx, link, "create", link.Owner); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertLink adds a link in a transaction and records its first revision.
+func (s *sqlStore) insertLink(tx *sql.Tx, link Link, action string, actor string) error {
+	_, err := tx.Exec(s.rebind("INSERT INTO items (name, url, singleword, count, arg_type, arg_regex, arg_alternate, owner, updated_at, generated, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		link.Name, link.URL, link.Singleword, link.Count, link.ArgType, link.ArgRegex, link.ArgAlternate, link.Owner, nullTimestamp(link.UpdatedAt), link.Generated, nullTimestamp(time.Now()))
+	if s.dialect.uniqueViolation(err) {
+		return ErrTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	var id int
+	err = tx.QueryRow(s.rebind("SELECT id FROM items WHERE name = ?"), link.Name).Scan(&id)
+	if err != nil {
+		return err
+	}
+	err = s.addRevision(tx, id, action, nil, versionOf(link), actor)
+	if err != nil {
+		return err
+	}
+
+	// The new link takes over a deprecated keyword with the same name
+	_, err = tx.Exec(s.rebind("DELETE FROM aliases WHERE LOWER(name) = LOWER(?)"), link.Name)
+	return err
+}
+
+func (s *sqlStore) ApplyImport(plan ImportPlan, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, link := range plan.Add {
+		if err := s.insertLink(tx, link, "import", actor); err != nil {
+			return fmt.Errorf("adding %s: %w", link.Name, err)
+		}
+	}
+	for _, link := range plan.Replace {
+		previous, err := scanLink(tx.QueryRow(s.rebind("SELECT "+linkColumns+" FROM items WHERE name = ?"), link.Name))
+		if err != nil {
+			return fmt.Errorf("replacing %s: %w", link.Name, err)
+		}
+		_, err = tx.Exec(s.rebind("UPDATE items SET url = ?, singleword = ?, count = ?, arg_type = ?, arg_regex = ?, arg_alternate = ?, updated_at = ? WHERE id = ?"),
+			link.URL, link.Singleword, link.Count, link.ArgType, link.ArgRegex, link.ArgAlternate, nullTimestamp(link.UpdatedAt), previous.ID)
+		if err != nil {
+			return fmt.Errorf("replacing %s: %w", link.Name, err)
+		}
+		before, after := versionOf(previous), versionOf(link)
+		if *before != *after {
+			if err := s.addRevision(tx, previous.ID, "import", before, after, actor); err != nil {
+				return err
+			}
+		}
+	}
+	for name, count := range plan.AddCounts {
+		_, err = tx.Exec(s.rebind("UPDATE items SET count = count + ? WHERE name = ?"), count, name)
+		if err != nil {
+			return err
+		}
+	}
+	for setting, value := range plan.Settings {
+		_, err = tx.Exec(s.rebind("UPDATE settings SET value = ? WHERE setting = ?"), value, setting)
+		if err != nil {
+			return err
+		}
+	}
+	for name, value := range plan.Variables {
+		_, err = tx.Exec(s.rebind("INSERT INTO settings (setting, value) VALUES (?, ?) ON CONFLICT (setting) DO UPDATE SET value = excluded.value"), variablePrefix+name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) UpdateLink(name string, link Link, aliasUntil time.Time, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	previous, err := scanLink(tx.QueryRow(s.rebind("SELECT "+linkColumns+" FROM items WHERE LOWER(name) = LOWER(?)"), name))
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	name = previous.Name
+
+	_, err = tx.Exec(s.rebind("UPDATE items SET name = ?, url = ?, singleword = ?, arg_type = ?, arg_regex = ?, arg_alternate = ?, updated_at = ? WHERE id = ?"),
+		link.Name, link.URL, link.Singleword, link.ArgType, link.ArgRegex, link.ArgAlternate, nullTimestamp(link.UpdatedAt), previous.ID)
+	if err != nil {
+		return err
+	}
+
+	// Saving the form unchanged isn't worth a revision
+	before, after := versionOf(previous), versionOf(link)
+	if *before != *after {
+		err = s.addRevision(tx, previous.ID, "update", before, after, actor)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !strings.EqualFold(name, link.Name) {
+		// The new name takes over a deprecated keyword, older names follow the rename
+		_, err = tx.Exec(s.rebind("DELETE FROM aliases WHERE LOWER(name) = LOWER(?)"), link.Name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(s.rebind("UPDATE aliases SET target = ? WHERE LOWER(target) = LOWER(?)"), link.Name, name)
+		if err != nil {
+			return err
+		}
+		if !aliasUntil.IsZero() {
+			_, err = tx.Exec(s.rebind("INSERT INTO aliases (name, target, expires_at) VALUES (?, ?, ?)"), name, link.Name, nullTimestamp(aliasUntil))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) DeleteLink(name string, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	link, err := scanLink(tx.QueryRow(s.rebind("SELECT "+linkColumns+" FROM items WHERE LOWER(name) = LOWER(?)"), name))
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(s.rebind("INSERT INTO trash (link_id, name, url, singleword, count, arg_type, arg_regex, arg_alternate, owner, updated_at, generated, created_at, deleted_by, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		link.ID, link.Name, link.URL, link.Singleword, link.Count, link.ArgType, link.ArgRegex, link.ArgAlternate, link.Owner, nullTimestamp(link.UpdatedAt), link.Generated, nullTimestamp(link.CreatedAt), actor, nullTimestamp(time.Now()))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(s.rebind("DELETE FROM items WHERE id = ?"), link.ID)
+	if err != nil {
+		return err
+	}
+	err = s.addRevision(tx, link.ID, "delete", versionOf(link), nil, actor)
+	if err != nil {
+		return err
+	}
+
+	// Deprecated names of the link have nowhere to go anymore
+	_, err = tx.Exec(s.rebind("DELETE FROM aliases WHERE LOWER(target) = LOWER(?)"), name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const trashColumns = linkColumns + ", link_id, deleted_by, deleted_at"
+
+func (s *sqlStore) ListTrash() ([]TrashedLink, error) {
+	rows, err := s.query("SELECT " + trashColumns + " FROM trash ORDER BY deleted_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trash []TrashedLink
+	for rows.Next() {
+		trashed, err := scanTrashedLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		trash = append(trash, trashed)
+	}
+	return trash, rows.Err()
+}
+
+func scanTrashedLink(row scanner) (TrashedLink, error) {
+	var trashed TrashedLink
+	var updatedAt, createdAt sql.NullTime
+	link := &trashed.Link
+	err := row.Scan(&link.ID, &link.Name, &link.URL, &link.Singleword, &link.Count, &link.ArgType, &link.ArgRegex, &link.ArgAlternate, &link.Owner, &updatedAt, &link.Generated, &createdAt, &trashed.LinkID, &trashed.DeletedBy, &trashed.DeletedAt)
+	if updatedAt.Valid {
+		link.UpdatedAt = updatedAt.Time
+	}
+	if createdAt.Valid {
+		link.CreatedAt = createdAt.Time
+	}
+	return trashed, err
+}
+
+func (s *sqlStore) RestoreLink(id int, actor string) (Link, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Link{}, err
+	}
+	defer tx.Rollback()
+
+	trashed, err := scanTrashedLink(tx.QueryRow(s.rebind("SELECT "+trashColumns+" FROM trash WHERE id = ?"), id))
+	if err == sql.ErrNoRows {
+		return Link{}, ErrNotFound
+	}
+	if err != nil {
+		return Link{}, err
+	}
+	link := trashed.Link
+
+	// The link gets its ID back so its revisions follow it. Links trashed before the
+	// trash kept their ID get a new one.
+	var taken int
+	err = tx.QueryRow(s.rebind("SELECT COUNT(id) FROM items WHERE id = ?"), trashed.LinkID).Scan(&taken)
+	if err != nil {
+		return Link{}, err
+	}
+	if trashed.LinkID > 0 && taken == 0 {
+		link.ID = trashed.LinkID
+		_, err = tx.Exec(s.rebind("INSERT INTO items (id, name, url, singleword, count, arg_type, arg_regex, arg_alternate, owner, updated_at, generated, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+			link.ID, link.Name, link.URL, link.Singleword, link.Count, link.ArgType, link.ArgRegex, link.ArgAlternate, link.Owner, nullTimestamp(link.UpdatedAt), link.Generated, nullTimestamp(link.CreatedAt))
+	} else {
+		_, err = tx.Exec(s.rebind("INSERT INTO items (name, url, singleword, count, arg_type, arg_regex, arg_alternate, owner, updated_at, generated, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+			link.Name, link.URL, link.Singleword, link.Count, link.ArgType, link.ArgRegex, link.ArgAlternate, link.Owner, nullTimestamp(link.UpdatedAt), link.Generated, nullTimestamp(link.CreatedAt))
+		if err == nil {
+			err = tx.QueryRow(s.rebind("SELECT id FROM items WHERE name = ?"), link.Name).Scan(&link.ID)
+		}
+	}
+	if err != nil {
+		return Link{}, err
+	}
+	err = s.addRevision(tx, link.ID, "restore", nil, versionOf(link), actor)
+	if err != nil {
+		return Link{}, err
+	}
+	_, err = tx.Exec(s.rebind("DELETE FROM aliases WHERE LOWER(name) = LOWER(?)"), link.Name)
+	if err != nil {
+		return Link{}, err
+	}
+	_, err = tx.Exec(s.rebind("DELETE FROM trash WHERE id = ?"), id)
+	if err != nil {
+		return Link{}, err
+	}
+
+	return link, tx.Commit()
+}
+
+func (s *sqlStore) DeleteTrashed(id int) error {
+	return changedRow(s.exec("DELETE FROM trash WHERE id = ?", id))
+}
+
+func (s *sqlStore) PurgeTrash(before time.Time) (int64, error) {
+	result, err := s.exec("DELETE FROM trash WHERE deleted_at <= ?", nullTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// addRevision records a change of a link in the transaction making it.
+func (s *sqlStore) addRevision(tx *sql.Tx, linkID int, action string, before *LinkVersion, after *LinkVersion, actor string) error {
+	beforeState, err := versionJSON(before)
+	if err != nil {
+		return err
+	}
+	afterState, err := versionJSON(after)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(s.rebind("INSERT INTO revisions (link_id, action, before_state, after_state, actor, created_at) VALUES (?, ?, ?, ?, ?, ?)"),
+		linkID, action, beforeState, afterState, actor, nullTimestamp(time.Now()))
+	return err
+}
+
+func versionJSON(version *LinkVersion) (any, error) {
+	if version == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(version)
+	return string(data), err
+}
+
+const revisionColumns = "id, link_id, action, before_state, after_state, actor, created_at"
+
+func scanRevision(row scanner) (Revision, error) {
+	var revision Revision
+	var before, after sql.NullString
+	err := row.Scan(&revision.ID, &revision.LinkID, &revision.Action, &before, &after, &revision.Actor, &revision.CreatedAt)
+	if err != nil {
+		return revision, err
+	}
+	if before.Valid {
+		revision.Before = &LinkVersion{}
+		if err := json.Unmarshal([]byte(before.String), revision.Before); err != nil {
+			return revision, err
+		}
+	}
+	if after.Valid {
+		revision.After = &LinkVersion{}
+		if err := json.Unmarshal([]byte(after.String), revision.After); err != nil {
+			return revision, err
+		}
+	}
+	return revision, nil
+}
+
+func (s *sqlStore) LinkRevisions(linkID int) ([]Revision, error) {
+	rows, err := s.query("SELECT "+revisionColumns+" FROM revisions WHERE link_id = ? ORDER BY id DESC", linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *sqlStore) GetRevision(id int) (Revision, error) {
+	revision, err := scanRevision(s.queryRow("SELECT "+revisionColumns+" FROM revisions WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return revision, ErrNotFound
+	}
+	return revision, err
+}
+
+func (s *sqlStore) CountLinksContaining(text string) (int, error) {
+	var count int
+	err := s.queryRow("SELECT COUNT(name) FROM items WHERE REPLACE(url, ?, '') <> url", text).Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) PruneShortLinks(before time.Time, unusedOnly bool) (int64, error) {
+	// Links from before creation times were recorded and never updated since have none,
+	// their age is unknown and they are kept
+	query := "DELETE FROM items WHERE generated = 1 AND created_at <= ?"
+	if unusedOnly {
+		query += " AND count = 0"
+	}
+	result, err := s.exec(query, nullTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *sqlStore) KeywordTaken(keyword string) (bool, error) {
+	var taken int
+	err := s.queryRow(`SELECT
+		(SELECT COUNT(name) FROM items WHERE LOWER(name) = LOWER(?)) +
+		(SELECT COUNT(name) FROM aliases WHERE LOWER(name) = LOWER(?)) +
+		(SELECT COUNT(setting) FROM settings WHERE setting LIKE 'keyword_%' AND LOWER(value) = LOWER(?))`,
+		keyword, keyword, keyword).Scan(&taken)
+	return taken > 0, err
+}
+
+func (s *sqlStore) IncrementCount(name string) error {
+	_, err := s.exec("UPDATE items SET count = count + 1 WHERE name = ?", name)
+	return err
+}
+
+func (s *sqlStore) ResetCount(name string) error {
+	return changedRow(s.exec("UPDATE items SET count = 0 WHERE LOWER(name) = LOWER(?)", name))
+}
+
+func (s *sqlStore) ResetAllCounts() (int64, error) {
+	result, err := s.exec("UPDATE items SET count = 0 WHERE count <> 0")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *sqlStore) ListAliases(now time.Time) ([]Alias, error) {
+	rows, err := s.query("SELECT name, target, expires_at, count FROM aliases WHERE expires_at > ? ORDER BY name ASC", nullTimestamp(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []Alias
+	for rows.Next() {
+		var alias Alias
+		if err := rows.Scan(&alias.Name, &alias.Target, &alias.ExpiresAt, &alias.Count); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+func (s *sqlStore) GetAlias(name string, now time.Time) (Alias, error) {
+	var alias Alias
+	err := s.queryRow("SELECT name, target, expires_at, count FROM aliases WHERE LOWER(name) = LOWER(?) AND expires_at > ?", name, nullTimestamp(now)).Scan(&alias.Name, &alias.Target, &alias.ExpiresAt, &alias.Count)
+	if err == sql.ErrNoRows {
+		return alias, ErrNotFound
+	}
+	return alias, err
+}
+
+func (s *sqlStore) IncrementAliasCount(name string) error {
+	_, err := s.exec("UPDATE aliases SET count = count + 1 WHERE LOWER(name) = LOWER(?)", name)
+	return err
+}
+
+func (s *sqlStore) DeleteAlias(name string) error {
+	return changedRow(s.exec("DELETE FROM aliases WHERE LOWER(name) = LOWER(?)", name))
+}
+
+func (s *sqlStore) PurgeAliases(now time.Time) error {
+	_, err := s.exec("DELETE FROM aliases WHERE expires_at <= ?", nullTimestamp(now))
+	return err
+}
+
+func (s *sqlStore) Settings() (map[string]string, error) {
+	rows, err := s.query("SELECT setting, value FROM settings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var setting, value string
+		if err := rows.Scan(&setting, &value); err != nil {
+			return nil, err
+		}
+		settings[setting] = value
+	}
+	return settings, rows.Err()
+}
+
+func (s *sqlStore) GetSetting(setting string) (string, error) {
+	var value string
+	err := s.queryRow("SELECT value FROM settings WHERE setting = ?", setting).Scan(&value)
+	if err == sql.ErrNoRows {
+		return value, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *sqlStore) SetSetting(setting string, value string) error {
+	_, err := s.exec("UPDATE settings SET value = ? WHERE setting = ?", value, setting)
+	return err
+}
+
+// Instance-wide variables are stored in settings as "var:NAME"
+const variablePrefix = "var:"
+
+func (s *sqlStore) Variables() (map[string]string, error) {
+	rows, err := s.query("SELECT setting, value FROM settings WHERE setting LIKE ?", variablePrefix+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vars := make(map[string]string)
+	for rows.Next() {
+		var setting, value string
+		if err := rows.Scan(&setting, &value); err != nil {
+			return nil, err
+		}
+		vars[strings.TrimPrefix(setting, variablePrefix)] = value
+	}
+	return vars, rows.Err()
+}
+
+func (s *sqlStore) AddVariable(name string, value string) error {
+	_, err := s.exec("INSERT INTO settings (setting, value) VALUES (?, ?)", variablePrefix+name, value)
+	return err
+}
+
+func (s *sqlStore) UpdateVariable(oldName string, name string, value string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = changedRow(tx.Exec(s.rebind("UPDATE settings SET setting = ?, value = ? WHERE setting = ?"), variablePrefix+name, value, variablePrefix+oldName))
+	if err != nil {
+		return err
+	}
+
+	// A rename follows through to the links and the fallback URL using the variable
+	if oldName != name {
+		_, err = tx.Exec(s.rebind("UPDATE items SET url = REPLACE(url, ?, ?)"), "${"+oldName+"}", "${"+name+"}")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(s.rebind("UPDATE settings SET value = REPLACE(value, ?, ?) WHERE setting = 'fallback_url'"), "${"+oldName+"}", "${"+name+"}")
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) DeleteVariable(name string) error {
+	return changedRow(s.exec("DELETE FROM settings WHERE setting = ?", variablePrefix+name))
+}
+
+func (s *sqlStore) LogQuery(keyword string) error {
+	_, err := s.exec("INSERT INTO queries (keyword) VALUES (?)", keyword)
+	return err
+}
+
+func (s *sqlStore) RecordVisits(visits Visits) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range visits.Queries {
+		_, err = tx.Exec(s.rebind("INSERT INTO queries (keyword, created_at) VALUES (?, ?)"), query.Keyword, nullTimestamp(query.CreatedAt))
+		if err != nil {
+			return err
+		}
+	}
+	for name, count := range visits.Counts {
+		_, err = tx.Exec(s.rebind("UPDATE items SET count = count + ? WHERE name = ?"), count, name)
+		if err != nil {
+			return err
+		}
+	}
+	for name, count := range visits.AliasCounts {
+		_, err = tx.Exec(s.rebind("UPDATE aliases SET count = count + ? WHERE LOWER(name) = LOWER(?)"), count, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) RecentQueries(limit int) ([]Query, error) {
+	rows, err := s.query("SELECT keyword, created_at FROM queries ORDER BY created_at DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queries []Query
+	for rows.Next() {
+		var query Query
+		if err := rows.Scan(&query.Keyword, &query.CreatedAt); err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	return queries, rows.Err()
+}
+
+func (s *sqlStore) ClearQueries() (int64, error) {
+	result, err := s.exec("DELETE FROM queries")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *sqlStore) AddAuditEntry(entry AuditEntry) error {
+	_, err := s.exec("INSERT INTO audit_log (created_at, actor, ip, action, target, before_value, after_value) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		nullTimestamp(entry.CreatedAt), entry.Actor, entry.IP, entry.Action, entry.Target, entry.Before, entry.After)
+	return err
+}
+
+func (s *sqlStore) AuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	query := "SELECT id, created_at, actor, ip, action, target, before_value, after_value FROM audit_log WHERE 1 = 1"
+	var args []any
+	if filter.Actor != "" {
+		query += " AND LOWER(actor) = LOWER(?)"
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		query += " AND action LIKE ?"
+		args = append(args, filter.Action+"%")
+	}
+	if filter.Search != "" {
+		query += " AND (LOWER(target) LIKE LOWER(?) OR LOWER(before_value) LIKE LOWER(?) OR LOWER(after_value) LIKE LOWER(?))"
+		pattern := "%" + filter.Search + "%"
+		args = append(args, pattern, pattern, pattern)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, nullTimestamp(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, nullTimestamp(filter.Until))
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		err := rows.Scan(&entry.ID, &entry.CreatedAt, &entry.Actor, &entry.IP, &entry.Action, &entry.Target, &entry.Before, &entry.After)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddLinkTaken(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	if err := store.AddLink(Link{Name: "gh", URL: "https://github.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddLink(Link{Name: "gh", URL: "https://gitlab.com"}); err != ErrTaken {
+		t.Errorf("adding a taken name returned %v, want ErrTaken", err)
+	}
+}
+
+func TestPruneShortLinksUsesCreationTime(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	// Edited long ago, but created just now
+	err := store.AddLink(Link{Name: "k3y9x", URL: "https://example.com", UpdatedAt: time.Now().AddDate(-1, 0, 0), Generated: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := store.PruneShortLinks(time.Now().AddDate(0, 0, -1), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 0 {
+		t.Errorf("pruned %d links created today, want 0", pruned)
+	}
+
+	pruned, err = store.PruneShortLinks(time.Now().Add(time.Minute), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned %d links, want 1", pruned)
+	}
+}
+
+func TestPruneShortLinksKeepsLegacyLinks(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	// A short link from before creation times were recorded, whose last update wasn't either
+	_, err := store.db.Exec("INSERT INTO items (name, url, generated, updated_at, created_at) VALUES ('k3y9x', 'https://example.com', 1, NULL, NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := store.PruneShortLinks(time.Now().Add(time.Minute), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 0 {
+		t.Errorf("pruned %d links without a creation time, want 0", pruned)
+	}
+	if _, err := store.GetLink("k3y9x"); err != nil {
+		t.Errorf("legacy link: %v", err)
+	}
+}
+
+func TestDeleteAndRestoreKeepCreationTime(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	if err := store.AddLink(Link{Name: "gh", URL: "https://github.com"}); err != nil {
+		t.Fatal(err)
+	}
+	link, err := store.GetLink("gh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.CreatedAt.IsZero() {
+		t.Fatal("new link has no creation time")
+	}
+
+	if err := store.DeleteLink("gh", ""); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := store.ListTrash()
+	if err != nil || len(trash) != 1 {
+		t.Fatalf("trash = %v, %v", trash, err)
+	}
+	restored, err := store.RestoreLink(trash[0].ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.CreatedAt.Equal(link.CreatedAt) {
+		t.Errorf("restored link created at %v, want %v", restored.CreatedAt, link.CreatedAt)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	store := &sqlStore{dialect: postgresDialect}
+	for _, test := range []struct {
+		query string
+		want  string
+	}{
+		{"SELECT id FROM items WHERE name = ?", "SELECT id FROM items WHERE name = $1"},
+		{"UPDATE items SET url = ? WHERE name = ? AND count > ?", "UPDATE items SET url = $1 WHERE name = $2 AND count > $3"},
+		{"INSERT INTO items (name, url) VALUES ('amzn', 'https://www.amazon.com/s?k=%s')", "INSERT INTO items (name, url) VALUES ('amzn', 'https://www.amazon.com/s?k=%s')"},
+		{"UPDATE settings SET value = 'what''s up?' WHERE setting = ?", "UPDATE settings SET value = 'what''s up?' WHERE setting = $1"},
+	} {
+		if got := store.rebind(test.query); got != test.want {
+			t.Errorf("rebind(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+
+	sqlite := &sqlStore{dialect: sqliteDialect}
+	if got := sqlite.rebind("SELECT ?"); got != "SELECT ?" {
+		t.Errorf("SQLite query rewritten to %q", got)
+	}
+}
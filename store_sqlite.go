@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var sqliteDialect = dialect{
+	driver:           "sqlite3",
+	autoIncrement:    "INTEGER PRIMARY KEY AUTOINCREMENT",
+	currentTimestamp: "CURRENT_TIMESTAMP",
+	columnsQuery:     "SELECT name FROM pragma_table_info(?)",
+	uniqueViolation: func(err error) bool {
+		var sqliteErr sqlite3.Error
+		return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	},
+	appendOnly: func(table string) []string {
+		return []string{
+			"CREATE TRIGGER IF NOT EXISTS " + table + "_no_update BEFORE UPDATE ON " + table + " BEGIN SELECT RAISE(ABORT, '" + table + " is append-only'); END",
+			"CREATE TRIGGER IF NOT EXISTS " + table + "_no_delete BEFORE DELETE ON " + table + " BEGIN SELECT RAISE(ABORT, '" + table + " is append-only'); END",
+		}
+	},
+}
+
+// newSQLiteStore opens the SQLite database at path, creating and seeding it if needed.
+func newSQLiteStore(path string) (*sqlStore, error) {
+	return openSQLStore(sqliteDialect, path)
+}
+
+// Backup copies the database with VACUUM INTO, which works on a live database and
+// includes what is still in the WAL, then runs an integrity check on the copy.
+func (s *sqlStore) Backup(path string) error {
+	if s.dialect.driver != sqliteDialect.driver {
+		return ErrUnsupported
+	}
+
+	_, err := s.db.Exec("VACUUM INTO ?", path)
+	if err != nil {
+		return err
+	}
+
+	if err := checkSQLiteFile(path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// checkSQLiteFile opens a database file read-only and runs PRAGMA integrity_check on it.
+func checkSQLiteFile(path string) error {
+	db, err := sql.Open(sqliteDialect.driver, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	err = db.QueryRow("PRAGMA integrity_check").Scan(&result)
+	if err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
+
+// readSQLiteBackup checks a backup file can be restored and returns its links: it must pass
+// the integrity check, have the links table and not come from a newer GoMarks.
+func readSQLiteBackup(path string) ([]Link, error) {
+	if err := checkSQLiteFile(path); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(sqliteDialect.driver, "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// Backups taken before the schema was versioned have no schema_version table
+	var versioned int
+	err = db.QueryRow("SELECT COUNT(name) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&versioned)
+	if err != nil {
+		return nil, err
+	}
+	if versioned > 0 {
+		var version int
+		err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+		if version > schemaVersion {
+			return nil, fmt.Errorf("backup schema version %d is newer than the %d supported by this binary", version, schemaVersion)
+		}
+	}
+
+	// Only the columns of the first schema are read, they exist in every backup
+	rows, err := db.Query("SELECT name, url, singleword FROM items ORDER BY name ASC")
+	if err != nil {
+		return nil, fmt.Errorf("not a GoMarks database: %w", err)
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		var link Link
+		if err := rows.Scan(&link.Name, &link.URL, &link.Singleword); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// Restore copies the backup over the live database with SQLite's online backup API, so the
+// connections in use see the restored content without reopening the database.
+func (s *sqlStore) Restore(path string) error {
+	if s.dialect.driver != sqliteDialect.driver {
+		return ErrUnsupported
+	}
+
+	src, err := sql.Open(sqliteDialect.driver, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	ctx := context.Background()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	dstConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	err = dstConn.Raw(func(dst any) error {
+		return srcConn.Raw(func(src any) error {
+			backup, err := dst.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// Older backups are upgraded like an older database on startup
+	return s.migrate()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// Pending visits beyond this are dropped rather than slowing redirects down, see the
+	// README. It takes thousands of redirects within a batch write to fill it.
+	visitQueueSize = 4096
+	// A batch is written when it reaches this size or when the interval is over
+	visitBatchSize     = 500
+	visitFlushInterval = time.Second
+)
+
+// visitWriter takes the writes of the redirect hot path, queries history and visit counts,
+// off the request: they are queued and written in batches by a background goroutine.
+// Redirects never wait for the database nor fail because of it. Close flushes what is left.
+//
+// Counter resets write the queued visits first, otherwise visits counted before the reset
+// would be added back right after it.
+type visitWriter struct {
+	Store
+
+	mu      sync.RWMutex // guards closed, so nothing is queued once the queue is closed
+	closed  bool
+	queue   chan visitEvent
+	flushes chan chan struct{} // Flush asks run to write what is queued, and waits
+	done    chan struct{}
+
+	// Held while a batch is written, and during a restore so no batch lands in the
+	// database being replaced
+	writing sync.Mutex
+}
+
+type visitEvent struct {
+	query string // a query, or else a visit of link or alias
+	link  string
+	alias string
+	at    time.Time
+}
+
+func newVisitWriter(store Store) *visitWriter {
+	w := &visitWriter{
+		Store:   store,
+		queue:   make(chan visitEvent, visitQueueSize),
+		flushes: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *visitWriter) enqueue(event visitEvent) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+
+	select {
+	case w.queue <- event:
+	default:
+		log.Println("Visit queue is full, dropping a visit")
+	}
+}
+
+func (w *visitWriter) LogQuery(keyword string) error {
+	w.enqueue(visitEvent{query: keyword, at: time.Now()})
+	return nil
+}
+
+func (w *visitWriter) IncrementCount(name string) error {
+	w.enqueue(visitEvent{link: name})
+	return nil
+}
+
+func (w *visitWriter) IncrementAliasCount(name string) error {
+	w.enqueue(visitEvent{alias: name})
+	return nil
+}
+
+// Flush writes the visits queued so far and returns once they are in the database.
+func (w *visitWriter) Flush() {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	w.flushes <- flushed
+	w.mu.RUnlock()
+	<-flushed
+}
+
+func (w *visitWriter) ResetCount(name string) error {
+	w.Flush()
+	return w.Store.ResetCount(name)
+}
+
+func (w *visitWriter) ResetAllCounts() (int64, error) {
+	w.Flush()
+	return w.Store.ResetAllCounts()
+}
+
+// Restore writes the visits queued before it to the database being replaced, and holds
+// the ones coming meanwhile until the restored database is in place.
+func (w *visitWriter) Restore(path string) error {
+	w.Flush()
+	w.writing.Lock()
+	defer w.writing.Unlock()
+	return w.Store.Restore(path)
+}
+
+func (w *visitWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(visitFlushInterval)
+	defer ticker.Stop()
+
+	batch := newVisits()
+	pending := 0
+	flush := func() {
+		if pending == 0 {
+			return
+		}
+		w.writing.Lock()
+		err := w.Store.RecordVisits(batch)
+		w.writing.Unlock()
+		if err != nil {
+			log.Printf("Failed to record %d visits: %v", pending, err)
+		}
+		batch = newVisits()
+		pending = 0
+	}
+
+	add := func(event visitEvent) {
+		switch {
+		case event.query != "":
+			batch.Queries = append(batch.Queries, Query{Keyword: event.query, CreatedAt: event.at})
+		case event.link != "":
+			batch.Counts[event.link]++
+		case event.alias != "":
+			batch.AliasCounts[event.alias]++
+		}
+		pending++
+		if pending >= visitBatchSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			add(event)
+		case flushed := <-w.flushes:
+			// Everything queued before the request is written, what comes later waits
+			for queued := len(w.queue); queued > 0; queued-- {
+				add(<-w.queue)
+			}
+			flush()
+			close(flushed)
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func newVisits() Visits {
+	return Visits{Counts: make(map[string]int), AliasCounts: make(map[string]int)}
+}
+
+// Close writes the queued visits, then closes the wrapped Store.
+func (w *visitWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+	return w.Store.Close()
+}
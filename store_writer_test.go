@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestVisitWriterResetCountWritesQueuedVisits(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	if err := store.AddLink(Link{Name: "gh", URL: "https://github.com"}); err != nil {
+		t.Fatal(err)
+	}
+	writer := newVisitWriter(store)
+
+	for i := 0; i < 3; i++ {
+		writer.IncrementCount("gh")
+	}
+	if err := writer.ResetCount("gh"); err != nil {
+		t.Fatal(err)
+	}
+	writer.Flush()
+
+	link, err := store.GetLink("gh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Count != 0 {
+		t.Errorf("count after reset = %d, want 0", link.Count)
+	}
+}
+
+func TestVisitWriterResetAllCountsWritesQueuedVisits(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	if err := store.AddLink(Link{Name: "gh", URL: "https://github.com"}); err != nil {
+		t.Fatal(err)
+	}
+	writer := newVisitWriter(store)
+
+	writer.IncrementCount("gh")
+	if _, err := writer.ResetAllCounts(); err != nil {
+		t.Fatal(err)
+	}
+	writer.Flush()
+
+	link, err := store.GetLink("gh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Count != 0 {
+		t.Errorf("count after reset = %d, want 0", link.Count)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Exports are documented in the README. Any change to their layout bumps exportVersion,
+// and imports keep reading the older versions.
+const (
+	exportFormat  = "gomarks"
+	exportVersion = 1
+)
+
+// exportFile is the layout of JSON and YAML exports.
+type exportFile struct {
+	Format     string            `json:"format" yaml:"format"`
+	Version    int               `json:"version" yaml:"version"`
+	ExportedAt time.Time         `json:"exported_at" yaml:"exported_at"`
+	Links      []exportLink      `json:"links" yaml:"links"`
+	Settings   map[string]string `json:"settings,omitempty" yaml:"settings,omitempty"`
+	Variables  map[string]string `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+type exportLink struct {
+	Name         string     `json:"name" yaml:"name"`
+	URL          string     `json:"url" yaml:"url"`
+	Singleword   bool       `json:"singleword,omitempty" yaml:"singleword,omitempty"`
+	Count        int        `json:"count,omitempty" yaml:"count,omitempty"`
+	ArgType      string     `json:"arg_type,omitempty" yaml:"arg_type,omitempty"`
+	ArgRegex     string     `json:"arg_regex,omitempty" yaml:"arg_regex,omitempty"`
+	ArgAlternate string     `json:"arg_alternate,omitempty" yaml:"arg_alternate,omitempty"`
+	Owner        string     `json:"owner,omitempty" yaml:"owner,omitempty"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty" yaml:"updated_at,omitempty"`
+	Generated    bool       `json:"generated,omitempty" yaml:"generated,omitempty"`
+}
+
+func exportLinkOf(link Link) exportLink {
+	e := exportLink{
+		Name:         link.Name,
+		URL:          link.URL,
+		Singleword:   link.Singleword == 1,
+		Count:        link.Count,
+		ArgType:      link.ArgType,
+		ArgRegex:     link.ArgRegex,
+		ArgAlternate: link.ArgAlternate,
+		Owner:        link.Owner,
+		Generated:    link.Generated == 1,
+	}
+	if !link.UpdatedAt.IsZero() {
+		updatedAt := link.UpdatedAt.UTC()
+		e.UpdatedAt = &updatedAt
+	}
+	return e
+}
+
+func (e exportLink) link() Link {
+	link := Link{
+		Name:         strings.TrimSpace(e.Name),
+		URL:          strings.TrimSpace(e.URL),
+		Count:        e.Count,
+		ArgType:      e.ArgType,
+		ArgRegex:     e.ArgRegex,
+		ArgAlternate: e.ArgAlternate,
+		Owner:        e.Owner,
+	}
+	if e.Singleword {
+		link.Singleword = 1
+	}
+	if e.Generated {
+		link.Generated = 1
+	}
+	if e.UpdatedAt != nil {
+		link.UpdatedAt = *e.UpdatedAt
+	}
+	return link
+}
+
+// exportAll gathers the links, settings and variables of the instance.
+func (s *server) exportAll() (exportFile, error) {
+	file := exportFile{
+		Format:     exportFormat,
+		Version:    exportVersion,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Links:      []exportLink{},
+		Settings:   make(map[string]string),
+	}
+
+	links, err := s.store.ListLinks()
+	if err != nil {
+		return file, err
+	}
+	for _, link := range links {
+		file.Links = append(file.Links, exportLinkOf(link))
+	}
+
+	settings, err := s.store.Settings()
+	if err != nil {
+		return file, err
+	}
+	for setting, value := range settings {
+		if !strings.HasPrefix(setting, variablePrefix) {
+			file.Settings[setting] = value
+		}
+	}
+	file.Variables, err = s.store.Variables()
+	return file, err
+}
+
+// parseExport reads a JSON or YAML export, telling them apart by their first character.
+func parseExport(data []byte) (exportFile, error) {
+	var file exportFile
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return file, fmt.Errorf("not a valid JSON or YAML file: %w", err)
+	}
+
+	if file.Format != exportFormat {
+		return file, errors.New(`not a GoMarks export, "format" should be "gomarks"`)
+	}
+	if file.Version < 1 || file.Version > exportVersion {
+		return file, fmt.Errorf("export format version %d is not supported by this binary, which reads versions 1 to %d", file.Version, exportVersion)
+	}
+	return file, nil
+}
+
+// rows returns the links of an export as import rows.
+func (file exportFile) rows() []importRow {
+	var rows []importRow
+	for i, e := range file.Links {
+		rows = append(rows, importRow{Row: i + 1, Link: e.link()})
+	}
+	return rows
+}
+
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	file, err := s.exportAll()
+	if err != nil {
+		http.Error(w, "Failed to export.", http.StatusInternalServerError)
+		return
+	}
+
+	name := "gomarks-export-" + time.Now().Format(backupTimestampLayout)
+	switch r.FormValue("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(file)
+	case "yaml":
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.yaml"`)
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		err = encoder.Encode(file)
+		if closeErr := encoder.Close(); err == nil {
+			err = closeErr
+		}
+	case "csv":
+		// Only links fit in a spreadsheet
+		var links []Link
+		links, err = s.store.ListLinks()
+		if err != nil {
+			http.Error(w, "Failed to export.", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		err = writeCSV(w, links)
+	case "html":
+		var links []Link
+		links, err = s.store.ListLinks()
+		if err != nil {
+			http.Error(w, "Failed to export.", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.html"`)
+		err = writeBookmarks(w, links, file.Variables)
+	default:
+		http.Error(w, "Unknown export format, use json, yaml, csv or html.", http.StatusBadRequest)
+		return
+	}
+
+	// The download has started, a failure can only cut it short
+	if err != nil {
+		log.Println("Export failed with error:", err)
+	}
+}
+
+func (s *server) handleImport(w http.ResponseWriter, r *http.Request) {
+	// Render the export and import page
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	</head>
+	<body>
+		<h2><a href="/">Export</a></h2>
+		Links with their counters, settings and variables, to move them to another instance or keep them in version control. (<a href="/help/#transfer">?</a>)</p>
+		<button onclick="window.location.href = '/export?format=json'">Export JSON</button>
+		<button onclick="window.location.href = '/export?format=yaml'">Export YAML</button>
+		<button onclick="window.location.href = '/export?format=csv'">Export CSV</button>
+		<button onclick="window.location.href = '/export?format=html'">Export bookmarks</button></p>
+		CSV exports only hold the links, for spreadsheets. Bookmark files hold them for browsers, with their keyword, which Firefox uses like GoMarks does.</p>
+
+		<h2>Import</h2>
+		<form action="/import-post" method="post" enctype="multipart/form-data">
+			<input type="file" name="file" required>
+			<button type="submit">Preview</button></p>
+			Bookmark files exported by browsers are imported too. Bookmarks keep their Firefox keyword, the others get one made from their folder and title. Keywords defined in Chrome or Firefox import from a copy of the <code>Web Data</code> or <code>places.sqlite</code> file of their profile.</p>
+			CSV files need a header row. Columns named like the export, or keyword, link, visits..., are found on their own, otherwise give their header:</p>
+			<input type="text" name="column_name" placeholder="Keyword column" autocomplete="off">
+			<input type="text" name="column_url" placeholder="URL column" autocomplete="off">
+			<input type="text" name="column_singleword" placeholder="Single option column" autocomplete="off">
+			<input type="text" name="column_count" placeholder="Count column" autocomplete="off">
+		</form>
+		You see what the file changes before anything is imported, and choose what happens to keywords that exist with another URL. Links and settings their form would refuse are left out, the other settings and the variables in the file replace the current ones.
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("import").Parse(tmpl))
+	tmplParsed.Execute(w, nil)
+}
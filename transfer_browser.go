@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Browsers keep their keywords in SQLite databases of the profile directory: Chrome (and
+// Chromium, Edge, Brave...) in the keywords table of "Web Data", with {searchTerms} where
+// the query goes, Firefox in moz_keywords of places.sqlite, with %s like GoMarks.
+
+// isSQLiteFile reports whether data starts like an SQLite database.
+func isSQLiteFile(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("SQLite format 3\x00"))
+}
+
+// readBrowserKeywords reads the keywords of a Chrome "Web Data" or Firefox places.sqlite
+// file. Browsers lock these files while running, so they are read from a copy.
+func readBrowserKeywords(data []byte) ([]importRow, error) {
+	file, err := os.CreateTemp("", "gomarks-import-*.sqlite")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// immutable, as the write-ahead log of the browser isn't there
+	db, err := sql.Open(sqliteDialect.driver, "file:"+file.Name()+"?mode=ro&immutable=1")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tables := make(map[string]bool)
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		return nil, fmt.Errorf("not a readable SQLite database: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables[name] = true
+	}
+	rows.Close()
+
+	switch {
+	case tables["keywords"]:
+		return readChromeKeywords(db)
+	case tables["moz_keywords"]:
+		return readFirefoxKeywords(db)
+	case tables["items"]:
+		return nil, errors.New("this is a GoMarks database, restore it from the backups page instead")
+	}
+	return nil, errors.New(`not a browser profile database, import Chrome's "Web Data" or Firefox's places.sqlite`)
+}
+
+func readChromeKeywords(db *sql.DB) ([]importRow, error) {
+	rows, err := db.Query("SELECT keyword, url, usage_count, last_modified FROM keywords ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var imported []importRow
+	for rows.Next() {
+		var keyword, url string
+		var usage, modified int64
+		if err := rows.Scan(&keyword, &url, &usage, &modified); err != nil {
+			return nil, err
+		}
+
+		row := importRow{Row: len(imported) + 1, Link: Link{Name: strings.TrimSpace(keyword), Count: int(usage)}}
+		row.Link.URL, row.err = chromeURL(strings.TrimSpace(url))
+		if modified > 0 {
+			// Microseconds since 1601, the Windows epoch
+			row.Link.UpdatedAt = time.Unix(modified/1000000-11644473600, 0).UTC()
+		}
+		imported = append(imported, row)
+	}
+	return imported, rows.Err()
+}
+
+var chromePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// chromeURL converts the placeholders of a Chrome search engine URL: {searchTerms}
+// becomes %s, the optional ones, ending with ?, are dropped. The others are filled by
+// Chrome with values of its own, like the Google domain of the user.
+func chromeURL(url string) (string, error) {
+	unknown := ""
+	converted := chromePlaceholder.ReplaceAllStringFunc(url, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		switch {
+		case name == "searchTerms":
+			return "%s"
+		case name == "inputEncoding" || name == "outputEncoding":
+			return "UTF-8"
+		case strings.HasSuffix(name, "?"):
+			return ""
+		}
+		if unknown == "" {
+			unknown = placeholder
+		}
+		return placeholder
+	})
+	if unknown != "" {
+		return url, fmt.Errorf("The Chrome placeholder %s can't be converted.", unknown)
+	}
+	return converted, nil
+}
+
+func readFirefoxKeywords(db *sql.DB) ([]importRow, error) {
+	rows, err := db.Query(`
+		SELECT k.keyword, p.url, COALESCE(k.post_data, ''), COALESCE(p.visit_count, 0),
+			COALESCE((SELECT MAX(b.lastModified) FROM moz_bookmarks b WHERE b.fk = p.id), 0)
+		FROM moz_keywords k JOIN moz_places p ON p.id = k.place_id
+		ORDER BY k.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var imported []importRow
+	for rows.Next() {
+		var keyword, url, postData string
+		var visits, modified int64
+		if err := rows.Scan(&keyword, &url, &postData, &visits, &modified); err != nil {
+			return nil, err
+		}
+
+		// %S is the query not escaped, GoMarks has a single placeholder
+		row := importRow{Row: len(imported) + 1, Link: Link{
+			Name:  strings.TrimSpace(keyword),
+			URL:   strings.ReplaceAll(strings.TrimSpace(url), "%S", "%s"),
+			Count: int(visits),
+		}}
+		if modified > 0 {
+			row.Link.UpdatedAt = time.UnixMicro(modified).UTC()
+		}
+		if postData != "" {
+			row.err = errPostKeyword
+		}
+		imported = append(imported, row)
+	}
+	return imported, rows.Err()
+}
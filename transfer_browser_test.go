@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChromeURL(t *testing.T) {
+	for _, test := range []struct {
+		url  string
+		want string
+		ok   bool
+	}{
+		{"https://duckduckgo.com/?q={searchTerms}", "https://duckduckgo.com/?q=%s", true},
+		{"https://example.com/?q={searchTerms}&ie={inputEncoding}&oe={outputEncoding}", "https://example.com/?q=%s&ie=UTF-8&oe=UTF-8", true},
+		{"https://example.com/?q={searchTerms}&{startPage?}", "https://example.com/?q=%s&", true},
+		{"https://example.com/wiki", "https://example.com/wiki", true},
+		{"{google:baseURL}search?q={searchTerms}", "{google:baseURL}search?q={searchTerms}", false},
+	} {
+		got, err := chromeURL(test.url)
+		if got != test.want || (err == nil) != test.ok {
+			t.Errorf("chromeURL(%q) = %q, %v, want %q, converted %v", test.url, got, err, test.want, test.ok)
+		}
+	}
+}
+
+// browserDatabase returns the content of an SQLite database made by the statements.
+func browserDatabase(t *testing.T, statements ...string) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "profile.sqlite")
+	db, err := sql.Open(sqliteDialect.driver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReadChromeKeywords(t *testing.T) {
+	data := browserDatabase(t,
+		"CREATE TABLE keywords (id INTEGER PRIMARY KEY, keyword TEXT, url TEXT, usage_count INTEGER, last_modified INTEGER)",
+		// 13345000000000000 µs after 1601 is 2023-11-21 00:26:40 UTC
+		"INSERT INTO keywords (keyword, url, usage_count, last_modified) VALUES ('ddg', 'https://duckduckgo.com/?q={searchTerms}', 4, 13345000000000000)",
+		"INSERT INTO keywords (keyword, url, usage_count, last_modified) VALUES ('google.com', '{google:baseURL}search?q={searchTerms}', 0, 0)",
+	)
+	if !isSQLiteFile(data) {
+		t.Fatal("the database isn't recognized as SQLite")
+	}
+
+	rows, err := readBrowserKeywords(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("read %d keywords, want 2", len(rows))
+	}
+	ddg := rows[0].Link
+	if ddg.Name != "ddg" || ddg.URL != "https://duckduckgo.com/?q=%s" || ddg.Count != 4 || ddg.UpdatedAt.Unix() != 1700526400 || rows[0].err != nil {
+		t.Errorf("ddg = %+v, %v", ddg, rows[0].err)
+	}
+	if rows[1].err == nil {
+		t.Errorf("google.com was read without error: %+v", rows[1].Link)
+	}
+}
+
+func TestReadFirefoxKeywords(t *testing.T) {
+	data := browserDatabase(t,
+		"CREATE TABLE moz_places (id INTEGER PRIMARY KEY, url TEXT, visit_count INTEGER)",
+		"CREATE TABLE moz_keywords (id INTEGER PRIMARY KEY, keyword TEXT, place_id INTEGER, post_data TEXT)",
+		"CREATE TABLE moz_bookmarks (id INTEGER PRIMARY KEY, fk INTEGER, lastModified INTEGER)",
+		"INSERT INTO moz_places VALUES (1, 'https://github.com/search?q=%s', 9), (2, 'https://example.com/search', 0)",
+		"INSERT INTO moz_keywords VALUES (1, 'gh', 1, NULL), (2, 'form', 2, 'q=%s')",
+		"INSERT INTO moz_bookmarks VALUES (1, 1, 1700000000000000)",
+	)
+
+	rows, err := readBrowserKeywords(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("read %d keywords, want 2", len(rows))
+	}
+	gh := rows[0].Link
+	if gh.Name != "gh" || gh.URL != "https://github.com/search?q=%s" || gh.Count != 9 || gh.UpdatedAt.Unix() != 1700000000 {
+		t.Errorf("gh = %+v", gh)
+	}
+	if rows[1].err != errPostKeyword {
+		t.Errorf("form keyword read with %v, want errPostKeyword", rows[1].err)
+	}
+}
+
+func TestReadBrowserKeywordsRefusesGoMarks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.db")
+	store, err := newSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readBrowserKeywords(data); err == nil {
+		t.Error("a GoMarks database was read as a browser profile")
+	}
+}
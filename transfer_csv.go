@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns are the columns of CSV exports, in order, with the headers recognized for
+// them on import. Headers are matched ignoring case and surrounding spaces.
+var csvColumns = []struct {
+	field   string
+	headers []string
+}{
+	{"name", []string{"name", "keyword", "shortcut", "key"}},
+	{"url", []string{"url", "link", "destination", "address", "target"}},
+	{"singleword", []string{"singleword", "single", "single option"}},
+	{"count", []string{"count", "visits", "hits"}},
+	{"arg_type", []string{"arg_type", "constraint"}},
+	{"arg_regex", []string{"arg_regex", "regex"}},
+	{"arg_alternate", []string{"arg_alternate", "alternate"}},
+	{"owner", []string{"owner", "author"}},
+	{"updated_at", []string{"updated_at", "updated"}},
+	{"generated", []string{"generated"}},
+}
+
+// writeCSV writes links as CSV, with a header row.
+func writeCSV(w io.Writer, links []Link) error {
+	writer := csv.NewWriter(w)
+	var header []string
+	for _, column := range csvColumns {
+		header = append(header, column.field)
+	}
+	writer.Write(header)
+
+	for _, link := range links {
+		updatedAt := ""
+		if !link.UpdatedAt.IsZero() {
+			updatedAt = link.UpdatedAt.UTC().Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			link.Name,
+			link.URL,
+			strconv.Itoa(link.Singleword),
+			strconv.Itoa(link.Count),
+			link.ArgType,
+			link.ArgRegex,
+			link.ArgAlternate,
+			link.Owner,
+			updatedAt,
+			strconv.Itoa(link.Generated),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// readCSV reads links from a CSV file. Columns are found by their header, mapping gives
+// the header of a field when it isn't one of the recognized ones. Spreadsheets exported
+// with semicolons instead of commas are read too.
+func readCSV(data []byte, mapping map[string]string) ([]importRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // byte order mark added by Excel
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("the file has no header row")
+	}
+
+	// Find the column of each field
+	index := make(map[string]int)
+	for _, column := range csvColumns {
+		headers := column.headers
+		if mapped := strings.TrimSpace(mapping[column.field]); mapped != "" {
+			headers = []string{mapped}
+		}
+		for i, h := range header {
+			for _, candidate := range headers {
+				if strings.EqualFold(strings.TrimSpace(h), candidate) {
+					if _, found := index[column.field]; !found {
+						index[column.field] = i
+					}
+				}
+			}
+		}
+	}
+	for _, field := range []string{"name", "url"} {
+		if _, found := index[field]; !found {
+			return nil, fmt.Errorf("no %s column among %s, name it %s or give its header", field, strings.Join(header, ", "), field)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		value := func(field string) string {
+			i, found := index[field]
+			if !found || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		row := importRow{Row: line, Link: Link{
+			Name:         value("name"),
+			URL:          value("url"),
+			ArgType:      value("arg_type"),
+			ArgRegex:     value("arg_regex"),
+			ArgAlternate: value("arg_alternate"),
+			Owner:        value("owner"),
+		}}
+		row.Link.Singleword, row.err = csvBool(value("singleword"), "Single option")
+		if row.err == nil {
+			row.Link.Generated, row.err = csvBool(value("generated"), "Generated")
+		}
+		if row.err == nil && value("count") != "" {
+			row.Link.Count, row.err = strconv.Atoi(value("count"))
+			if row.err != nil || row.Link.Count < 0 {
+				row.err = errors.New("Count must be a positive whole number.")
+			}
+		}
+		if row.err == nil && value("updated_at") != "" {
+			row.Link.UpdatedAt, row.err = time.Parse(time.RFC3339, value("updated_at"))
+			if row.err != nil {
+				row.err = errors.New("Last update must be a date like 2024-12-31T08:00:00Z.")
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// csvBool reads the flags spreadsheets hold as 1/0, yes/no, true/false or x/empty.
+func csvBool(value string, field string) (int, error) {
+	switch strings.ToLower(value) {
+	case "", "0", "no", "false", "off":
+		return 0, nil
+	case "1", "yes", "true", "on", "x":
+		return 1, nil
+	}
+	return 0, fmt.Errorf("%s must be yes or no.", field)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Browsers export and import bookmarks in the Netscape bookmark file format: loose HTML
+// where folders are <H3> titles followed by a <DL> list, and bookmarks are <A> tags.
+// Firefox keeps the keyword of a bookmark in its SHORTCUTURL attribute.
+const bookmarksDoctype = "<!DOCTYPE NETSCAPE-Bookmark-file-1>"
+
+var (
+	bookmarkTag       = regexp.MustCompile(`(?i)<(/?)([a-z0-9]+)((?:[^>"]|"[^"]*")*)>`)
+	bookmarkAttribute = regexp.MustCompile(`([A-Za-z_:-]+)\s*=\s*"([^"]*)"`)
+)
+
+// Firefox keywords can send their query as form data, GoMarks only redirects
+var errPostKeyword = errors.New("Keywords sending a form with POST are not supported.")
+
+// isBookmarksFile reports whether data starts like a Netscape bookmark file.
+func isBookmarksFile(data []byte) bool {
+	start := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	return len(start) >= len(bookmarksDoctype) && strings.EqualFold(string(start[:len(bookmarksDoctype)]), bookmarksDoctype)
+}
+
+// writeBookmarks writes links as a Netscape bookmark file, in a GoMarks folder, with
+// their keyword as SHORTCUTURL. Browsers don't know GoMarks variables, so they are
+// replaced by their value.
+func writeBookmarks(w io.Writer, links []Link, vars map[string]string) error {
+	var b strings.Builder
+	b.WriteString(bookmarksDoctype + "\n")
+	b.WriteString("<!-- This is an automatically generated file.\n     It will be read and overwritten.\n     DO NOT EDIT! -->\n")
+	b.WriteString(`<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">` + "\n")
+	b.WriteString("<TITLE>Bookmarks</TITLE>\n<H1>Bookmarks</H1>\n<DL><p>\n")
+	b.WriteString("    <DT><H3>GoMarks</H3>\n    <DL><p>\n")
+	for _, link := range links {
+		dates := ""
+		if !link.UpdatedAt.IsZero() {
+			unix := strconv.FormatInt(link.UpdatedAt.Unix(), 10)
+			dates = ` ADD_DATE="` + unix + `" LAST_MODIFIED="` + unix + `"`
+		}
+		fmt.Fprintf(&b, "        <DT><A HREF=\"%s\"%s SHORTCUTURL=\"%s\">%s</A>\n",
+			html.EscapeString(expandVariables(link.URL, vars)), dates, html.EscapeString(link.Name), html.EscapeString(link.Name))
+	}
+	b.WriteString("    </DL><p>\n</DL><p>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// bookmark is a bookmark read from a file, before it gets a keyword.
+type bookmark struct {
+	line    int
+	title   string
+	folder  string
+	keyword string
+	link    Link
+	err     error
+}
+
+// readBookmarks reads links from a Netscape bookmark file. Bookmarks with a keyword keep
+// it, the others get one made from their folder and title, like dev-github for GitHub in
+// a Dev folder.
+func readBookmarks(data []byte) ([]importRow, error) {
+	if !isBookmarksFile(data) {
+		return nil, errors.New("not a bookmark file, it should start with " + bookmarksDoctype)
+	}
+	text := string(data)
+
+	var bookmarks []bookmark
+	var folders []string // from the outermost, "" for the ones left out of keywords
+	pending := ""
+	for _, match := range bookmarkTag.FindAllStringSubmatchIndex(text, -1) {
+		closing := text[match[2]:match[3]] == "/"
+		tag := strings.ToUpper(text[match[4]:match[5]])
+		attributes := bookmarkAttributes(text[match[6]:match[7]])
+
+		// Titles are the text up to the next tag
+		title := text[match[1]:]
+		if end := strings.IndexByte(title, '<'); end >= 0 {
+			title = title[:end]
+		}
+		title = strings.TrimSpace(html.UnescapeString(title))
+
+		switch {
+		case tag == "H3" && !closing:
+			// The toolbar and other bookmarks folders are where browsers put everything
+			pending = title
+			if attributes["PERSONAL_TOOLBAR_FOLDER"] == "true" || attributes["UNFILED_BOOKMARKS_FOLDER"] == "true" {
+				pending = ""
+			}
+		case tag == "DL" && !closing:
+			folders = append(folders, pending)
+			pending = ""
+		case tag == "DL" && closing:
+			if len(folders) > 0 {
+				folders = folders[:len(folders)-1]
+			}
+		case tag == "A" && !closing:
+			bookmarks = append(bookmarks, readBookmark(attributes, title, folders, strings.Count(text[:match[0]], "\n")+1))
+		}
+	}
+	if len(bookmarks) == 0 {
+		return nil, errors.New("the file has no bookmarks")
+	}
+
+	// Keywords given in the file win over the generated ones
+	taken := make(map[string]bool)
+	for _, b := range bookmarks {
+		if b.keyword != "" {
+			taken[strings.ToLower(b.keyword)] = true
+		}
+	}
+
+	var rows []importRow
+	for _, b := range bookmarks {
+		b.link.Name = b.keyword
+		if b.link.Name == "" && b.err == nil {
+			b.link.Name = generateKeyword(b.folder, b.title, taken)
+			taken[strings.ToLower(b.link.Name)] = true
+		}
+		rows = append(rows, importRow{Row: b.line, Link: b.link, err: b.err})
+	}
+	return rows, nil
+}
+
+func readBookmark(attributes map[string]string, title string, folders []string, line int) bookmark {
+	b := bookmark{
+		line:    line,
+		title:   title,
+		keyword: strings.TrimSpace(attributes["SHORTCUTURL"]),
+		link:    Link{URL: strings.TrimSpace(attributes["HREF"])},
+	}
+	for i := len(folders) - 1; i >= 0 && b.folder == ""; i-- {
+		b.folder = folders[i]
+	}
+
+	for _, attribute := range []string{"LAST_MODIFIED", "ADD_DATE"} {
+		if unix, err := strconv.ParseInt(attributes[attribute], 10, 64); err == nil && unix > 0 {
+			b.link.UpdatedAt = time.Unix(unix, 0).UTC()
+			break
+		}
+	}
+
+	if attributes["POST_DATA"] != "" {
+		b.err = errPostKeyword
+	}
+	return b
+}
+
+// bookmarkAttributes returns the attributes of a tag, by their name in upper case.
+func bookmarkAttributes(s string) map[string]string {
+	attributes := make(map[string]string)
+	for _, match := range bookmarkAttribute.FindAllStringSubmatch(s, -1) {
+		attributes[strings.ToUpper(match[1])] = html.UnescapeString(match[2])
+	}
+	return attributes
+}
+
+// generateKeyword makes a keyword from the first words of a folder and a title, adding -2,
+// -3... when it is taken by another bookmark of the file.
+func generateKeyword(folder string, title string, taken map[string]bool) string {
+	name := keywordWords(title, 3)
+	if name == "" {
+		name = "bookmark"
+	}
+	if prefix := keywordWords(folder, 2); prefix != "" {
+		name = prefix + "-" + name
+	}
+
+	candidate := name
+	for i := 2; taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return candidate
+}
+
+// keywordWords returns the first words of s in lower case, joined by dashes.
+func keywordWords(s string, max int) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	var kept []string
+	for _, word := range words {
+		word = strings.ReplaceAll(word, "'", "")
+		if word != "" && len(kept) < max {
+			kept = append(kept, word)
+		}
+	}
+	return strings.Join(kept, "-")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const firefoxBookmarks = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks Menu</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1700000000" PERSONAL_TOOLBAR_FOLDER="true">Bookmarks Toolbar</H3>
+    <DL><p>
+        <DT><A HREF="https://github.com/search?q=%s" ADD_DATE="1700000000" LAST_MODIFIED="1700000100" SHORTCUTURL="gh">GitHub</A>
+        <DT><A HREF="https://news.ycombinator.com/">Hacker News</A>
+        <DT><H3>Dev Tools</H3>
+        <DL><p>
+            <DT><A HREF="https://github.com/" ADD_DATE="1700000000">GitHub &amp; Co</A>
+            <DT><A HREF="https://gitlab.com/">GitHub and co</A>
+            <DT><A HREF="https://example.com/search" SHORTCUTURL="form" POST_DATA="q=%s">Search form</A>
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="https://www.rust-lang.org/">Rust's home</A>
+</DL><p>
+`
+
+func TestReadBookmarks(t *testing.T) {
+	rows, err := readBookmarks([]byte("\xef\xbb\xbf" + firefoxBookmarks))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		row  int
+		name string
+		url  string
+	}{
+		{8, "gh", "https://github.com/search?q=%s"},
+		{9, "hacker-news", "https://news.ycombinator.com/"},
+		{12, "dev-tools-github-co", "https://github.com/"},
+		{13, "dev-tools-github-and-co", "https://gitlab.com/"},
+		{14, "form", "https://example.com/search"},
+		{17, "rusts-home", "https://www.rust-lang.org/"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("read %d bookmarks, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		if rows[i].Row != w.row || rows[i].Link.Name != w.name || rows[i].Link.URL != w.url {
+			t.Errorf("bookmark %d = row %d %q %q, want row %d %q %q", i, rows[i].Row, rows[i].Link.Name, rows[i].Link.URL, w.row, w.name, w.url)
+		}
+	}
+
+	// The last modification wins over the addition
+	if !rows[0].Link.UpdatedAt.Equal(time.Unix(1700000100, 0)) {
+		t.Errorf("gh updated at %v", rows[0].Link.UpdatedAt)
+	}
+	if rows[4].err != errPostKeyword {
+		t.Errorf("form read with %v, want errPostKeyword", rows[4].err)
+	}
+}
+
+func TestReadBookmarksGeneratedKeywords(t *testing.T) {
+	// Generated keywords make way for the ones of the file, and for each other
+	file := bookmarksDoctype + `
+<DL><p>
+    <DT><A HREF="https://a.example.com">Example</A>
+    <DT><A HREF="https://b.example.com">Example</A>
+    <DT><A HREF="https://c.example.com" SHORTCUTURL="Example">C</A>
+    <DT><A HREF="https://d.example.com">!!!</A>
+</DL><p>`
+	rows, err := readBookmarks([]byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, row := range rows {
+		names = append(names, row.Link.Name)
+	}
+	if got := strings.Join(names, " "); got != "example-2 example-3 Example bookmark" {
+		t.Errorf("keywords = %s", got)
+	}
+}
+
+func TestReadBookmarksRefuses(t *testing.T) {
+	if _, err := readBookmarks([]byte("<html><a href=\"https://example.com\">x</a></html>")); err == nil {
+		t.Error("an HTML page was read as a bookmark file")
+	}
+	if _, err := readBookmarks([]byte(bookmarksDoctype + "\n<DL><p></DL><p>")); err == nil {
+		t.Error("a bookmark file without bookmarks was read")
+	}
+}
+
+func TestWriteBookmarksReadsBack(t *testing.T) {
+	links := []Link{
+		{Name: "ji", URL: "https://${JIRA}/browse/%s?a=1&b=2", UpdatedAt: time.Unix(1700000000, 0)},
+		{Name: "gh", URL: "https://github.com"},
+	}
+	var b bytes.Buffer
+	if err := writeBookmarks(&b, links, map[string]string{"JIRA": "jira.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := readBookmarks(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Link.Name != "ji" || rows[0].Link.URL != "https://jira.example.com/browse/%s?a=1&b=2" || !rows[0].Link.UpdatedAt.Equal(links[0].UpdatedAt) || rows[1].Link.Name != "gh" {
+		t.Errorf("read back %+v", rows)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// purgeTrash deletes the links that have been in the trash for longer than the trash_days
+// setting, 0 keeps them until they are deleted by hand.
+func (s *server) purgeTrash() error {
+	days, err := s.intSetting("trash_days")
+	if err != nil || days <= 0 {
+		return err
+	}
+
+	purged, err := s.store.PurgeTrash(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("Purged %d links from the trash", purged)
+	}
+	return nil
+}
+
+func (s *server) handleTrash(w http.ResponseWriter, r *http.Request) {
+	var item struct {
+		Days  string
+		Links []struct {
+			ID        int
+			Name      string
+			URL       string
+			Count     int
+			DeletedBy string
+			DeletedAt string
+			Age       string
+		}
+	}
+	days, err := s.store.GetSetting("trash_days")
+	if err != nil {
+		http.Error(w, "Trash settings not found.", http.StatusNotFound)
+		return
+	}
+	item.Days = days
+
+	trash, err := s.store.ListTrash()
+	if err != nil {
+		http.Error(w, "Failed to fetch the trash.", http.StatusInternalServerError)
+		return
+	}
+	for _, trashed := range trash {
+		item.Links = append(item.Links, struct {
+			ID        int
+			Name      string
+			URL       string
+			Count     int
+			DeletedBy string
+			DeletedAt string
+			Age       string
+		}{trashed.ID, trashed.Name, trashed.URL, trashed.Count, trashed.DeletedBy, trashed.DeletedAt.Format(time.RFC3339), formatAge(time.Since(trashed.DeletedAt))})
+	}
+
+	// Render the trash page
+	tmpl := `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>GoMarks</title>
+		<link rel="stylesheet" href="/static/style.css">
+	    <script>
+        function goToIndex() {
+            window.location.href = "/";
+        }
+    </script>
+	</head>
+	<body>
+		<h2><a href="/">Trash</a></h2>
+		<table class="links">
+			<tr>
+				<th style="text-align: left; width: 150px">Keyword</th>
+				<th style="text-align: left;">URL</th>
+				<th style="text-align: center; width: 60px">Count</th>
+				<th style="text-align: center; width: 150px">Deleted by</th>
+				<th style="text-align: center; width: 150px">Deleted</th>
+				<th style="text-align: center; width: 100px">Management</th>
+			</tr>
+			{{range .Links}}
+			<tr>
+				<td>{{.Name}}</td>
+				<td>{{.URL}}</td>
+				<td style="text-align: center;">{{.Count}}</td>
+				<td style="text-align: center;">{{if .DeletedBy}}{{.DeletedBy}}{{else}}-{{end}}</td>
+				<td style="text-align: center;" title="{{.DeletedAt}}">{{.Age}}</td>
+				<td style="text-align: center;">
+					<form action="/trash-restore/{{.ID}}" method="post" style="display: inline;">
+						<button type="submit" title="Restore link">♻️</button>
+					</form>
+					<form action="/trash-del/{{.ID}}" method="post" style="display: inline;">
+						<button type="submit" title="Delete for good" onclick="return confirm('Delete {{.Name}} for good?')">❌</button>
+					</form>
+				</td>
+			</tr>
+			{{else}}
+			<tr><td colspan="6">The trash is empty.</td></tr>
+			{{end}}
+		</table>
+		</p>
+
+		<form action="/trash-post/" method="post">
+			<label for="days">Days before deleted links are purged</label>
+			<input type="number" name="days" id="days" value="{{.Days}}" min="0" max="3650" required></p>
+			<button type="submit">Save</button></p>
+			<button type="button" onclick="goToIndex()">Cancel</button>
+		</form>
+		Deleted keywords are free for new links right away. Restoring a link brings back its visit count, set 0 days to keep deleted links until you delete them here.
+	</body>
+	</html>
+	`
+
+	tmplParsed := template.Must(template.New("trash").Parse(tmpl))
+	tmplParsed.Execute(w, item)
+}
+
+func (s *server) handleTrashPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days, err := strconv.Atoi(r.FormValue("days"))
+	if err != nil || days < 0 || days > 3650 {
+		http.Error(w, "Days before purging must be between 0 and 3650.", http.StatusBadRequest)
+		return
+	}
+
+	err = s.setSetting(r, "trash_days", strconv.Itoa(days))
+	if err != nil {
+		http.Error(w, "Failed to update trash settings.", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/?trash=updated", http.StatusSeeOther)
+}
+
+func (s *server) handleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Path[len("/trash-restore/"):])
+	if err != nil {
+		http.Error(w, "Deleted link not found.", http.StatusNotFound)
+		return
+	}
+
+	// The keyword may have been reused since the link was deleted
+	var trashed *TrashedLink
+	trash, err := s.store.ListTrash()
+	if err != nil {
+		http.Error(w, "Failed to fetch the trash.", http.StatusInternalServerError)
+		return
+	}
+	for i := range trash {
+		if trash[i].ID == id {
+			trashed = &trash[i]
+		}
+	}
+	if trashed == nil {
+		http.Error(w, "Deleted link not found.", http.StatusNotFound)
+		return
+	}
+	taken, err := s.store.KeywordTaken(trashed.Name)
+	if err != nil {
+		http.Error(w, "Failed to check the keyword.", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, "Keyword "+trashed.Name+" is used again, rename or delete what uses it before restoring this link.", http.StatusConflict)
+		return
+	}
+
+	link, err := s.store.RestoreLink(id, getActor(r))
+	if err != nil {
+		http.Error(w, "Failed to restore the link.", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "link.restore", link.Name, "", linkJSON(link))
+
+	http.Redirect(w, r, "/?undeleted="+link.Name, http.StatusSeeOther)
+}
+
+func (s *server) handleTrashDel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Path[len("/trash-del/"):])
+	if err != nil {
+		http.Error(w, "Deleted link not found.", http.StatusNotFound)
+		return
+	}
+
+	before := ""
+	trash, err := s.store.ListTrash()
+	if err != nil {
+		http.Error(w, "Failed to fetch the trash.", http.StatusInternalServerError)
+		return
+	}
+	for _, trashed := range trash {
+		if trashed.ID == id {
+			before = linkJSON(trashed.Link)
+		}
+	}
+
+	err = s.store.DeleteTrashed(id)
+	if err == ErrNotFound {
+		http.Error(w, "Deleted link not found.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete the link.", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "trash.delete", strconv.Itoa(id), before, "")
+
+	http.Redirect(w, r, "/trash/", http.StatusSeeOther)
+}